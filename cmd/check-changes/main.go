@@ -1,74 +1,200 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/lorentzforces/check-changes/internal/checking"
 	"github.com/lorentzforces/check-changes/internal/config"
 	"github.com/lorentzforces/check-changes/internal/git"
+	"github.com/lorentzforces/check-changes/internal/output"
 	"github.com/lorentzforces/check-changes/internal/platform"
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	status := run(ctx, "", os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(status)
+}
+
+// The conventional exit status for a process stopped by SIGINT.
+const interruptedStatus = 130
+
+// Runs check-changes against the repository containing dir (or the working directory, if dir is
+// empty), and returns the exit status.
+func run(ctx context.Context, dir string, args []string, stdout io.Writer, stderr io.Writer) int {
+	fail := func(err error) int {
+		fmt.Fprintln(stderr, platform.ErrMsg(err.Error()))
+		if errors.Is(err, context.Canceled) { return interruptedStatus }
+		return 1
+	}
+
 	opts := config.Default()
-	config.ApplyEnv(&opts)
 	flags := config.InitOpts(&opts)
-	flags.Parse(os.Args[1:])
-	opts.ParseRevs()
+	flags.SetOutput(stderr)
+	flags.Parse(args)
 
 	if opts.HelpRequested {
-		printUsage()
-		os.Exit(1)
+		printUsage(stderr)
+		return 1
 	}
 
 	if !git.ExecExists() {
-		platform.FailOut("\"git\" executable not found on system PATH")
+		return fail(fmt.Errorf("\"git\" executable not found on system PATH"))
+	}
+
+	// loading configuration runs git too, so a timeout from the command line applies to it; one
+	// from a config file can only apply once it's loaded, but is measured from here all the same
+	start := time.Now()
+	commandLineTimeout := opts.Timeout
+	if commandLineTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(commandLineTimeout))
+		defer cancel()
+	}
+
+	gitClient := git.NewClient(git.ExecRunner{}, dir)
+	err := config.Load(ctx, gitClient, &opts, flags, checking.ConfigDefaults())
+	if err != nil { return fail(err) }
+
+	if commandLineTimeout == 0 && opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(opts.Timeout))
+		defer cancel()
 	}
 
-	rev, _ := git.FirstValidRev(opts.ParsedRevs)
+	format, err := output.ParseFormat(opts.Format)
+	if err != nil { return fail(err) }
+	sortOrder, err := output.ParseSortOrder(opts.Sort)
+	if err != nil { return fail(err) }
+	colorMode, err := output.ParseColorMode(opts.Color)
+	if err != nil { return fail(err) }
+
+	positionalArgs := flags.Args()
+	if len(positionalArgs) > 0 {
+		err = runSubcommand(ctx, gitClient, &opts, positionalArgs, stdout)
+		if err != nil { return fail(err) }
+		return 0
+	}
 
-	checkData, err := checking.CheckChanges(rev)
-	platform.FailOnErr(err)
+	// with no valid rev, the diff is against HEAD
+	rev, err := gitClient.FirstValidRev(ctx, opts.ParsedRevs)
+	if err != nil && !errors.Is(err, git.ErrBadRev) { return fail(err) }
 
-	printResults(&opts, checkData)
+	if opts.PerCommit {
+		return runPerCommit(ctx, gitClient, &opts, rev, format, sortOrder, colorMode, stdout, fail)
+	}
 
-	if len(checkData.Errors) > 0 { os.Exit(1) }
+	checkData, err := checking.CheckChanges(ctx, gitClient, rev, &opts)
+	if err != nil { return fail(err) }
+	checkData = output.SortReport(checkData, sortOrder)
+	// only the checks which ran are reported as rules (or passing test cases)
+	enabledChecks, err := checking.EnabledChecks(opts.Settings)
+	if err != nil { return fail(err) }
+
+	switch format {
+		case output.FormatJSON:
+			err = output.WriteJSON(stdout, checkData)
+		case output.FormatSARIF:
+			err = output.WriteSARIF(stdout, checkData, enabledChecks)
+		case output.FormatJUnit:
+			err = output.WriteJUnit(stdout, checkData, enabledChecks)
+		case output.FormatCheckstyle:
+			err = output.WriteCheckstyle(stdout, checkData)
+		default:
+			textOpts := output.ResolveTextOpts(colorMode, isTerminal(stdout), os.Getenv("NO_COLOR"))
+			textOpts.HideContext = opts.HideContext
+			textOpts.ShowSuppressed = opts.ShowSuppressed
+			err = output.WriteText(stdout, checkData, textOpts)
+	}
+	if err != nil { return fail(err) }
+
+	if checkData.HasErrors() { return 1 }
+	return 0
 }
 
-func printResults(opts *config.Opts, results checking.CheckReport) {
-	hasErrors := len(results.Errors) > 0
-	hasWarnings := len(results.Warnings) > 0
-	if hasErrors {
-		fmt.Println("POTENTIAL MAJOR ISSUES:")
-		for _, errorFlag := range results.Errors {
-			fmt.Printf("  - %s\n", errorFlag.Message())
-			printContextMsg(opts, errorFlag)
-		}
-		if hasWarnings { fmt.Println("") }
+func runPerCommit(
+	ctx context.Context,
+	gitClient *git.Client,
+	opts *config.Opts,
+	rev string,
+	format output.Format,
+	sortOrder output.SortOrder,
+	colorMode output.ColorMode,
+	stdout io.Writer,
+	fail func(error) int,
+) int {
+	if len(rev) == 0 {
+		return fail(fmt.Errorf("--per-commit needs a valid rev to start from; pass one with --revs"))
+	}
+	if format != output.FormatText && format != output.FormatJSON {
+		return fail(fmt.Errorf("--per-commit only supports \"text\" and \"json\" output"))
 	}
 
-	if hasWarnings {
-		fmt.Println("POTENTIAL ISSUES:")
-		for _, warnFlag := range results.Warnings {
-			fmt.Printf("  - %s\n", warnFlag.Message())
-			printContextMsg(opts, warnFlag)
-		}
+	rangeReport, err := checking.CheckCommits(ctx, gitClient, rev, opts)
+	if err != nil { return fail(err) }
+	rangeReport = output.SortRangeReport(rangeReport, sortOrder)
+
+	if format == output.FormatJSON {
+		err = output.WriteCommitsJSON(stdout, rangeReport)
+	} else {
+		textOpts := output.ResolveTextOpts(colorMode, isTerminal(stdout), os.Getenv("NO_COLOR"))
+		textOpts.HideContext = opts.HideContext
+		textOpts.ShowSuppressed = opts.ShowSuppressed
+		err = output.WriteCommitsText(stdout, rangeReport, textOpts)
 	}
+	if err != nil { return fail(err) }
+
+	// only what's still present at HEAD can fail the run; fixed findings are history
+	if rangeReport.HasErrors() { return 1 }
+	return 0
 }
 
-func printContextMsg(opts *config.Opts, flag checking.CheckFlag) {
-	msg := flag.ContextMsg()
-	if !opts.HideContext && len(msg) > 0 {
-		fmt.Printf("    %s\n", msg)
+func runSubcommand(
+	ctx context.Context,
+	gitClient *git.Client,
+	opts *config.Opts,
+	args []string,
+	stdout io.Writer,
+) error {
+	if len(args) == 2 && args[0] == "config" && args[1] == "show" {
+		config.ShowConfig(stdout, opts.Settings)
+		return nil
+	}
+
+	if len(args) == 1 && args[0] == "baseline" {
+		rev, err := gitClient.FirstValidRev(ctx, opts.ParsedRevs)
+		if err != nil && !errors.Is(err, git.ErrBadRev) { return err }
+		count, err := checking.UpdateBaseline(ctx, gitClient, rev, opts)
+		if err != nil { return err }
+		fmt.Fprintf(stdout, "Recorded %d issue(s) in the baseline file %s\n", count, opts.BaselineFile)
+		return nil
 	}
+
+	return fmt.Errorf("Unknown command \"%s\"", strings.Join(args, " "))
+}
+
+func isTerminal(out io.Writer) bool {
+	file, isFile := out.(*os.File)
+	if !isFile { return false }
+	info, err := file.Stat()
+	if err != nil { return false }
+	return info.Mode() & os.ModeCharDevice != 0
 }
 
-// TODO: add information about all checks in here
-func printUsage() {
+func printUsage(out io.Writer) {
 	fmt.Fprint(
-		os.Stderr,
+		out,
 		`Usage of check-changes:  check-changes [OPTION]...
+                         check-changes baseline [OPTION]...
+                         check-changes config show
 
 Reads the current state of a git repository in the working directory, checking
 for any potential things which you may want to know about before checking in
@@ -90,10 +216,17 @@ later work, but needs to be committed for now.
 `,
 	)
 
-	fmt.Fprint(os.Stderr, config.EnvVarHelp())
+	fmt.Fprint(out, checking.ChecksHelp())
+
+	fmt.Fprint(out, "\n")
+	fmt.Fprint(out, config.ConfigHelp())
+
+	fmt.Fprint(out, "\n\n")
+	fmt.Fprint(out, config.EnvVarHelp())
 
-	fmt.Fprint(os.Stderr, "\n\nOPTIONS\n")
+	fmt.Fprint(out, "\n\nOPTIONS\n")
 
 	flags := config.InitOpts(&config.Opts{})
+	flags.SetOutput(out)
 	flags.PrintDefaults()
 }
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lorentzforces/check-changes/internal/git/gittest"
+	"github.com/stretchr/testify/assert"
+)
+
+func runIn(repo *gittest.Repo, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), repo.Dir, args, &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func newRepoWithCommit(t *testing.T) *gittest.Repo {
+	return gittest.NewRepo(t).
+		StageFile("main.go", "package main\n\nfunc main() {\n}\n").
+		Commit("initial commit")
+}
+
+func TestNothingStaged(t *testing.T) {
+	repo := newRepoWithCommit(t)
+
+	status, stdout, stderr := runIn(repo)
+	assert.Equal(t, 0, status)
+	assert.Empty(t, stdout)
+	assert.Empty(t, stderr)
+}
+
+func TestOnlyStagedChangesAreChecked(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		StageFile("main.go", "package main\n\nfunc main() {\n\t// TODO: something\n}\n").
+		WriteFile("main.go", "package main\n\nfunc main() {\n\t// TODO: something\n\t// NOCHECKIN\n}\n")
+
+	status, stdout, _ := runIn(repo)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, stdout, "main.go:4 | line contains keyword \"TODO\"")
+	assert.NotContains(t, stdout, "NOCHECKIN")
+}
+
+func TestMajorIssueFailsTheRun(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		StageFile("main.go", "package main\n\nfunc main() {\n\t// NOCHECKIN\n}\n")
+
+	status, stdout, _ := runIn(repo)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stdout, "POTENTIAL MAJOR ISSUES:")
+	assert.Contains(t, stdout, "main.go:4 | line contains keyword \"NOCHECKIN\"")
+}
+
+func TestSecretsAreRedactedFromEveryFinding(t *testing.T) {
+	// the secrets are split up so that this file doesn't contain any
+	password := "Xk9#" + "qLz7Vw2p"
+	awsKey := "AKIA" + "IOSFODNN7EXAMPLE"
+	repo := newRepoWithCommit(t).
+		StageFile(
+			"config.go",
+			"package main\n\n" +
+				"var dbPassword = \"" + password + "\" // TODO rotate \n" +
+				"var key = \"" + awsKey + "\" // NOCHECKIN\n",
+		)
+
+	status, stdout, _ := runIn(repo, "--format", "json")
+	assert.Equal(t, 1, status)
+	assert.NotContains(t, stdout, password)
+	assert.NotContains(t, stdout, awsKey)
+	assert.Contains(t, stdout, "\"keyword\": \"TODO\"")
+	assert.Contains(t, stdout, "\"keyword\": \"NOCHECKIN\"")
+	assert.Contains(t, stdout, "\"rule\": \"aws-access-key\"")
+	assert.Contains(t, stdout, "\"check\": \"trailing-whitespace\"")
+}
+
+func TestMultiLinePrivateKeysAreRedacted(t *testing.T) {
+	// the key is split up so that this file doesn't contain one
+	keyBody := []string{
+		"MIIEow" + "IBAAKCAQEAu1SU1LfVLPHCozMxH2Mo4lgOEePzNm0tRgeLezV6ffAt0gun",
+		"VTLw7on" + "LRnrq0/IzW7yWR7QkrmBL7jTKEn5u+qKhbwKfBstIs+bMY2Zkp18gnTxK",
+		"9GxNq2d" + "U0LB3bUQyyoL8y7ukF6eN1nSLhPZ8u8OGLsO3g5AhlGc3a8sBJkP1PcQ",
+	}
+	repo := newRepoWithCommit(t).
+		StageFile(
+			"key.pem",
+			"-----BEGIN RSA " + "PRIVATE KEY-----\r\n" +
+				keyBody[0] + "\r\n" +
+				// one line of the key has the wrong ending, which gets it reported
+				keyBody[1] + "\n" +
+				keyBody[2] + "\r\n" +
+				"-----END RSA PRIVATE KEY-----\r\n" +
+				"TODO: rotate\r\n",
+		)
+
+	status, stdout, _ := runIn(repo, "--format", "json")
+	assert.Equal(t, 1, status)
+	for _, line := range keyBody {
+		assert.NotContains(t, stdout, line)
+	}
+	assert.Contains(t, stdout, "\"rule\": \"private-key\"")
+	assert.Contains(t, stdout, "\"check\": \"line-ending\"")
+	// the key ends at its END line
+	assert.Contains(t, stdout, "\"lineContent\": \"TODO: rotate\"")
+}
+
+func TestRevsRange(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		Push().
+		Branch("feature").
+		StageFile("feature.go", "package main\n\n// NOCHECKIN\n").
+		Commit("add a feature").
+		StageFile("other.go", "package main\n")
+
+	// committed changes are only seen when diffing against an older rev
+	status, stdout, _ := runIn(repo)
+	assert.Equal(t, 0, status)
+	assert.Empty(t, stdout)
+
+	status, stdout, _ = runIn(repo, "--revs", "origin/main")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stdout, "feature.go:3 | line contains keyword \"NOCHECKIN\"")
+
+	// the first valid rev in the list is used
+	status, _, _ = runIn(repo, "--revs", "does-not-exist:main")
+	assert.Equal(t, 1, status)
+}
+
+func TestStashOnCurrentBranch(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		WriteFile("main.go", "package main\n\n// unfinished\n").
+		Stash("unfinished work")
+
+	status, stdout, _ := runIn(repo)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, stdout, "Stash entry {0} has stashed changes from your current branch")
+
+	repo.Branch("elsewhere")
+	status, stdout, _ = runIn(repo)
+	assert.Equal(t, 0, status)
+	assert.Empty(t, stdout)
+}
+
+func TestNotARepository(t *testing.T) {
+	gittest.IsolateConfig(t)
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), t.TempDir(), []string{}, &stdout, &stderr)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr.String(), "Not inside a git repository")
+}
+
+func TestUnknownCommand(t *testing.T) {
+	repo := newRepoWithCommit(t)
+	status, _, stderr := runIn(repo, "frobnicate")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "Unknown command \"frobnicate\"")
+}
+
+func TestHookIndexFileIsRespected(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		WriteFile("main.go", "package main\n\nfunc main() {\n\t// NOCHECKIN\n}\n")
+
+	// "git commit <paths>" and similar stage into a temporary index, and run hooks with
+	// GIT_INDEX_FILE pointing at it
+	altIndex := filepath.Join(repo.Dir, ".git", "alt-index")
+	t.Setenv("GIT_INDEX_FILE", altIndex)
+	repo.Git("read-tree", "HEAD")
+	repo.Stage("main.go")
+
+	status, stdout, _ := runIn(repo)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stdout, "main.go:4 | line contains keyword \"NOCHECKIN\"")
+
+	os.Unsetenv("GIT_INDEX_FILE")
+	status, stdout, _ = runIn(repo)
+	assert.Equal(t, 0, status)
+	assert.Empty(t, stdout)
+}
+
+func TestGlobalGitConfigIsRespected(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		WriteFile("stashed.txt", "stashed\n").
+		Stash("unfinished").
+		StageFile("main.go", "package main\n\nfunc main() {\n\t// FIXME\n}\n")
+	repo.Git("config", "--global", "corpa.keywords.error", "FIXME")
+	// color in git's output would break parsing it
+	repo.Git("config", "--global", "color.ui", "always")
+
+	status, stdout, _ := runIn(repo)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stdout, "main.go:4 | line contains keyword \"FIXME\"")
+	assert.Contains(t, stdout, "Stash entry {0} has stashed changes from your current branch")
+}
+
+func TestGitConfigCannotHideChanges(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		StageFile("sub/other.go", "package sub\n").
+		Commit("add a subdirectory").
+		StageFile("main.go", "package main\n\nfunc main() {\n\t// NOCHECKIN\n}\n")
+
+	for _, setting := range [][]string{
+		{"diff.external", "true"},
+		{"diff.relative", "true"},
+		{"diff.noprefix", "true"},
+		{"diff.mnemonicPrefix", "true"},
+	} {
+		repo.Git("config", "--global", setting[0], setting[1])
+
+		var stdout, stderr bytes.Buffer
+		// diff.relative only matters below the root of the repository
+		dir := filepath.Join(repo.Dir, "sub")
+		status := run(context.Background(), dir, []string{}, &stdout, &stderr)
+		assert.Equal(t, 1, status, setting[0])
+		assert.Contains(
+			t,
+			stdout.String(),
+			"main.go:4 | line contains keyword \"NOCHECKIN\"",
+			setting[0],
+		)
+
+		repo.Git("config", "--global", "--unset", setting[0])
+	}
+}
+
+func TestPerCommit(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		Push().
+		StageFile("feature.go", "package main\n\n// NOCHECKIN\n").
+		Commit("add a feature").
+		StageFile("feature.go", "package main\n").
+		Commit("finish the feature")
+
+	// the NOCHECKIN is only in the history, so it doesn't fail the run
+	status, stdout, _ := runIn(repo, "--per-commit", "--revs", "origin/main")
+	assert.Equal(t, 0, status)
+	assert.Contains(t, stdout, "commit "+repo.RevParse("HEAD~1")[:7]+" add a feature\n")
+	assert.Contains(t, stdout, "FIXED LATER IN THE RANGE (1):\n")
+	assert.Contains(t, stdout, "feature.go:3 | line contains keyword \"NOCHECKIN\"")
+	assert.NotContains(t, stdout, "finish the feature")
+
+	repo.StageFile("other.go", "package main\n\n// NOCHECKIN\n").Commit("add another")
+	status, stdout, _ = runIn(repo, "--per-commit", "--revs", "origin/main")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stdout, "commit "+repo.RevParse("HEAD")[:7]+" add another\n")
+
+	status, _, stderr := runIn(repo, "--per-commit")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "--revs")
+
+	status, _, stderr = runIn(repo, "--per-commit", "--revs", "origin/main", "--format", "sarif")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "only supports")
+}
+
+func TestPerCommitWithAMergeResolution(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		Push().
+		Branch("other").
+		StageFile("other.go", "package main\n").
+		Commit("add other")
+	repo.Checkout("main").
+		StageFile("feature.go", "package main\n").
+		Commit("add a feature")
+	repo.Git("merge", "--quiet", "--no-ff", "--no-commit", "other")
+	repo.StageFile("other.go", "package main\n\n// NOCHECKIN\n").Commit("merge other")
+
+	status, stdout, _ := runIn(repo, "--per-commit", "--revs", "origin/main")
+	assert.Equal(t, 1, status)
+	assert.Contains(
+		t,
+		stdout,
+		"not introduced by any single commit (such as by resolving a merge conflict)\n"+
+			"POTENTIAL MAJOR ISSUES:\n"+
+			"  - other.go:3 | line contains keyword \"NOCHECKIN\"\n",
+	)
+}
+
+func TestLineEndings(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		StageFile("notes.txt", "one\ntwo\nthree\n").
+		Commit("add notes").
+		StageFile("notes.txt", "one\ntwo\r\nthree\n")
+
+	status, stdout, _ := runIn(repo)
+	assert.Equal(t, 0, status)
+	assert.Contains(
+		t,
+		stdout,
+		"notes.txt:2 | line ends in CRLF, while most of the file's lines end in LF",
+	)
+
+	// more added CRLF lines than existing LF lines don't change what's expected
+	repo.StageFile("notes.txt", "one\ntwo\r\n2a\r\n2b\r\n2c\r\nthree\n")
+	status, stdout, _ = runIn(repo)
+	assert.Equal(t, 0, status)
+	for _, lineNumber := range []string{"2", "3", "4", "5"} {
+		assert.Contains(t, stdout, "notes.txt:" + lineNumber + " | line ends in CRLF")
+	}
+
+	// git leaves line endings alone in files which aren't text
+	repo.StageFile(".gitattributes", "*.txt -text\n")
+	status, stdout, _ = runIn(repo)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, stdout, "line ends in")
+}
+
+func TestTimeoutAppliesToLoadingConfig(t *testing.T) {
+	mkfifo, err := exec.LookPath("mkfifo")
+	if err != nil { t.Skip("mkfifo is not available") }
+	repo := newRepoWithCommit(t)
+
+	// git blocks opening a named pipe which nothing ever writes to
+	configDir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "git-corpa")
+	assert.NoError(t, os.MkdirAll(configDir, 0755))
+	assert.NoError(t, exec.Command(mkfifo, filepath.Join(configDir, "config")).Run())
+
+	start := time.Now()
+	status, _, stderr := runIn(repo, "--timeout", "200ms")
+	assert.Less(t, time.Since(start), 5 * time.Second)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "timed out")
+}
+
+func TestTimeoutFromConfigApplies(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		StageFile("main.go", "package main\n\nfunc main() {\n\t// NOCHECKIN\n}\n")
+	repo.Git("config", "corpa.check-changes.timeout", "1ns")
+
+	status, _, stderr := runIn(repo)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "timed out")
+}
+
+func TestDisabledChecksAreLeftOutOfReports(t *testing.T) {
+	repo := newRepoWithCommit(t).
+		StageFile("main.go", "package main\n\nfunc main() {\n\t// TODO: something\n}\n")
+	repo.Git("config", "corpa.check.stash.enabled", "false")
+
+	status, stdout, _ := runIn(repo, "--format", "junit")
+	assert.Equal(t, 0, status)
+	assert.Contains(t, stdout, `<testsuite name="keyword"`)
+	assert.Contains(t, stdout, `<testsuite name="indent"`)
+	assert.NotContains(t, stdout, `<testsuite name="stash"`)
+
+	status, stdout, _ = runIn(repo, "--format", "sarif")
+	assert.Equal(t, 0, status)
+	assert.Contains(t, stdout, `"id": "keyword"`)
+	assert.NotContains(t, stdout, `"id": "stash"`)
+}
@@ -0,0 +1,187 @@
+package checking
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/config"
+	"github.com/lorentzforces/check-changes/internal/git"
+)
+
+// Flags can provide the content which identifies them, independent of where they are in a file,
+// so that a baselined flag is still recognized after its line moves. Flags which don't are
+// identified by their message and context.
+type Fingerprinter interface {
+	FingerprintContent() string
+}
+
+// Identifies a finding by its check, its file, and its content (but not its line number).
+func Fingerprint(finding Finding) string {
+	return fingerprintIn(finding, finding.Flag.Location().File)
+}
+
+// The fingerprint the finding would have if it were in the given file.
+func fingerprintIn(finding Finding, file string) string {
+	var content string
+	if fingerprinter, ok := finding.Flag.(Fingerprinter); ok {
+		content = fingerprinter.FingerprintContent()
+	} else {
+		content = finding.Flag.Message() + "\x00" + finding.Flag.ContextMsg()
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{finding.Check, file, content} {
+		_, _ = io.WriteString(hash, part)
+		_, _ = hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Whitespace changes (such as re-indenting) shouldn't make a baselined flag new again.
+func normalizeFingerprintLine(line string) string {
+	return strings.Join(strings.Fields(line), " ")
+}
+
+const baselineVersion = 1
+
+// A set of accepted findings. Identical findings in the same file (the same TODO comment on two
+// lines, say) are counted, so that adding another copy is still reported.
+type Baseline struct {
+	Version int `json:"version"`
+	Findings []BaselineEntry `json:"findings"`
+}
+
+type BaselineEntry struct {
+	Check string `json:"check"`
+	File string `json:"file,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+	Count int `json:"count"`
+	// Only for the benefit of people reading the baseline file.
+	Message string `json:"message"`
+}
+
+func NewBaseline(findings []Finding) Baseline {
+	entries := make(map[string]*BaselineEntry)
+	for _, finding := range findings {
+		fingerprint := Fingerprint(finding)
+		entry, exists := entries[fingerprint]
+		if !exists {
+			entry = &BaselineEntry{
+				Check: finding.Check,
+				File: finding.Flag.Location().File,
+				Fingerprint: fingerprint,
+				Message: finding.Flag.Message(),
+			}
+			entries[fingerprint] = entry
+		}
+		entry.Count++
+	}
+
+	baseline := Baseline{
+		Version: baselineVersion,
+		Findings: make([]BaselineEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		baseline.Findings = append(baseline.Findings, *entry)
+	}
+	// sorted, so that the file only changes when the findings do
+	slices.SortFunc(baseline.Findings, func(a, b BaselineEntry) int {
+		return cmp.Or(
+			strings.Compare(a.File, b.File),
+			strings.Compare(a.Check, b.Check),
+			strings.Compare(a.Fingerprint, b.Fingerprint),
+		)
+	})
+	return baseline
+}
+
+func ReadBaseline(in io.Reader) (Baseline, error) {
+	baseline := Baseline{}
+	err := json.NewDecoder(in).Decode(&baseline)
+	if err != nil {
+		return Baseline{}, fmt.Errorf("Malformed baseline file: %w", err)
+	}
+	if baseline.Version != baselineVersion {
+		return Baseline{}, fmt.Errorf("Unsupported baseline file version %d", baseline.Version)
+	}
+	return baseline, nil
+}
+
+func (baseline Baseline) Write(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(baseline)
+}
+
+func baselinePath(repoRoot string, opts *config.Opts) string {
+	if len(opts.BaselineFile) == 0 { return "" }
+	if filepath.IsAbs(opts.BaselineFile) { return opts.BaselineFile }
+	return filepath.Join(repoRoot, opts.BaselineFile)
+}
+
+// A missing baseline file is the same as an empty baseline.
+func readBaselineFile(path string) (Baseline, error) {
+	if len(path) == 0 { return Baseline{Version: baselineVersion}, nil }
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) { return Baseline{Version: baselineVersion}, nil }
+	if err != nil { return Baseline{}, err }
+	defer file.Close()
+
+	baseline, err := ReadBaseline(file)
+	if err != nil { return Baseline{}, fmt.Errorf("%s: %w", path, err) }
+	return baseline, nil
+}
+
+// Move any findings which are in the baseline out of the report's findings.
+func applyBaseline(report *CheckReport, baseline Baseline) {
+	remaining := make(map[string]int, len(baseline.Findings))
+	for _, entry := range baseline.Findings {
+		remaining[entry.Fingerprint] += entry.Count
+	}
+
+	kept := make([]Finding, 0, len(report.Findings))
+	for _, finding := range report.Findings {
+		fingerprint := Fingerprint(finding)
+		if remaining[fingerprint] > 0 {
+			remaining[fingerprint]--
+			report.Baselined = append(report.Baselined, finding)
+			continue
+		}
+		kept = append(kept, finding)
+	}
+	report.Findings = kept
+}
+
+// Write every current finding (other than suppressed ones) to the baseline file, replacing
+// whatever it held before. Returns the number of findings written.
+func UpdateBaseline(
+	ctx context.Context,
+	gitClient *git.Client,
+	diffRev string,
+	opts *config.Opts,
+) (int, error) {
+	report, repoRoot, err := collectFindings(ctx, gitClient, diffRev, opts)
+	if err != nil { return 0, err }
+
+	path := baselinePath(repoRoot, opts)
+	if len(path) == 0 { return 0, fmt.Errorf("No baseline file is configured") }
+
+	file, err := os.Create(path)
+	if err != nil { return 0, err }
+	defer file.Close()
+
+	err = NewBaseline(report.Findings).Write(file)
+	if err != nil { return 0, err }
+	return len(report.Findings), file.Close()
+}
@@ -0,0 +1,97 @@
+package checking
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type ConflictMarkerFlag struct {
+	FileName string `json:"file"`
+	LineNumber uint `json:"line"`
+	Marker string `json:"marker"`
+	LineContent string `json:"lineContent"`
+}
+
+func (flag ConflictMarkerFlag) Message() string {
+	return fmt.Sprintf("line contains merge conflict marker \"%s\"", flag.Marker)
+}
+
+func (flag ConflictMarkerFlag) ContextMsg() string {
+	return trimReportedLine(flag.LineContent)
+}
+
+func (flag ConflictMarkerFlag) Location() Location {
+	return Location{File: flag.FileName, Line: flag.LineNumber, Column: 1}
+}
+
+func (flag ConflictMarkerFlag) FingerprintContent() string {
+	return flag.Marker + "\x00" + normalizeFingerprintLine(flag.LineContent)
+}
+
+func (flag ConflictMarkerFlag) HighlightedLine() (string, int, int) {
+	return flag.LineContent, 0, len(flag.Marker)
+}
+
+// Git's markers are 7 characters long, unless changed with the conflict-marker-size attribute
+// (which is rare enough to not be worth asking git about).
+const (
+	conflictOursMarker = "<<<<<<<"
+	conflictBaseMarker = "|||||||"
+	conflictSeparatorMarker = "======="
+	conflictTheirsMarker = ">>>>>>>"
+)
+
+// In these formats, a line of "=" characters underlines a heading.
+var headingUnderlineExtensions = []string{".md", ".markdown", ".rst"}
+
+type conflictMarkerCheck struct {
+	noHooks
+}
+
+func (conflictMarkerCheck) Name() string { return "conflict-marker" }
+
+func (conflictMarkerCheck) Description() string {
+	return "merge conflict markers left in added lines"
+}
+
+func (conflictMarkerCheck) DefaultSeverity() Severity { return SeverityError }
+
+func (conflictMarkerCheck) CheckFile(file *diffFile, out *flagSink) {
+	markers := make([]string, len(file.ChangedLines))
+	hasOtherMarkers := false
+	for i, line := range file.ChangedLines {
+		markers[i] = conflictMarkerOf(line.Content)
+		hasOtherMarkers = hasOtherMarkers ||
+			(len(markers[i]) > 0 && markers[i] != conflictSeparatorMarker)
+	}
+
+	// a separator on its own may just be a heading underline, but not when it's part of a conflict
+	extension := strings.ToLower(filepath.Ext(file.FileName))
+	allowLoneSeparators := !hasOtherMarkers && slices.Contains(headingUnderlineExtensions, extension)
+
+	for i, line := range file.ChangedLines {
+		if len(markers[i]) == 0 { continue }
+		if markers[i] == conflictSeparatorMarker && allowLoneSeparators { continue }
+		out.Flag(ConflictMarkerFlag{
+			FileName: file.FileName,
+			LineNumber: line.LineNumber,
+			Marker: markers[i],
+			LineContent: line.Content,
+		})
+	}
+}
+
+// The conflict marker a line starts with, or empty if it doesn't start with one. Marker lines are
+// the marker alone, or (other than the separator) the marker followed by a space and a label.
+func conflictMarkerOf(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if line == conflictSeparatorMarker { return conflictSeparatorMarker }
+
+	for _, marker := range []string{conflictOursMarker, conflictBaseMarker, conflictTheirsMarker} {
+		rest, hasMarker := strings.CutPrefix(line, marker)
+		if hasMarker && (len(rest) == 0 || rest[0] == ' ') { return marker }
+	}
+	return ""
+}
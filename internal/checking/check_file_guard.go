@@ -0,0 +1,201 @@
+package checking
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/config"
+)
+
+type LargeFileFlag struct {
+	FileName string `json:"file"`
+	Size int64 `json:"size"`
+	Limit int64 `json:"limit"`
+}
+
+func (flag LargeFileFlag) Message() string {
+	return fmt.Sprintf(
+		"file is %s, over the size limit of %s",
+		formatByteSize(flag.Size), formatByteSize(flag.Limit),
+	)
+}
+
+func (flag LargeFileFlag) ContextMsg() string {
+	return "consider Git LFS for large files, or raise check.file-guard.maxSize"
+}
+
+func (flag LargeFileFlag) Location() Location {
+	return Location{File: flag.FileName}
+}
+
+// Growing or shrinking a file which is already too large doesn't make it a new issue.
+func (flag LargeFileFlag) FingerprintContent() string {
+	return "large"
+}
+
+type BinaryFileFlag struct {
+	FileName string `json:"file"`
+	Size int64 `json:"size"`
+	AllowedPaths []string `json:"allowedPaths"`
+}
+
+func (flag BinaryFileFlag) Message() string {
+	return "binary file is outside the paths allowed to have binary files"
+}
+
+func (flag BinaryFileFlag) ContextMsg() string {
+	if len(flag.AllowedPaths) == 0 {
+		return "no paths are allowed to have binary files (see check.file-guard.allowBinary)"
+	}
+	return "allowed paths: " + strings.Join(flag.AllowedPaths, ", ")
+}
+
+func (flag BinaryFileFlag) Location() Location {
+	return Location{File: flag.FileName}
+}
+
+func (flag BinaryFileFlag) FingerprintContent() string {
+	return "binary"
+}
+
+type LFSPointerFlag struct {
+	FileName string `json:"file"`
+	Size int64 `json:"size"`
+}
+
+func (flag LFSPointerFlag) Message() string {
+	return "file is tracked by Git LFS in .gitattributes, but was staged as a regular file " +
+		"instead of an LFS pointer"
+}
+
+func (flag LFSPointerFlag) ContextMsg() string {
+	return "run \"git lfs install\", then stage the file again"
+}
+
+func (flag LFSPointerFlag) Location() Location {
+	return Location{File: flag.FileName}
+}
+
+func (flag LFSPointerFlag) FingerprintContent() string {
+	return "lfs"
+}
+
+const defaultMaxFileSize = "1m"
+
+type fileGuardCheck struct {
+	noHooks
+	// Zero means there's no limit.
+	maxSize int64
+	// Globs (like .gitignore patterns) of paths which may have binary files.
+	allowBinary []string
+}
+
+var defaultFileGuardCheck = fileGuardCheck{maxSize: 1024 * 1024}
+
+func fileGuardConfigDefaults() []config.Entry {
+	return []config.Entry{{
+		Key: checkKey(defaultFileGuardCheck, "maxSize"),
+		Value: defaultMaxFileSize,
+		Source: config.SourceDefault,
+	}}
+}
+
+func (fileGuardCheck) Name() string { return "file-guard" }
+
+func (fileGuardCheck) Description() string {
+	return "added or changed files which are too large, binary files outside allowed paths " +
+		"(a warning), and files tracked by Git LFS which were staged without it"
+}
+
+func (fileGuardCheck) DefaultSeverity() Severity { return SeverityError }
+
+func (check fileGuardCheck) configure(settings config.Settings) (Check, error) {
+	maxSizeSetting, _ := settings.Get(checkKey(check, "maxSize"))
+	maxSize, err := parseByteSize(maxSizeSetting.Value())
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Invalid value for %s: %w (from %s)",
+			checkKey(check, "maxSize"), err, maxSizeSetting.Source,
+		)
+	}
+
+	return fileGuardCheck{
+		maxSize: maxSize,
+		allowBinary: nonEmpty(settings.Values(checkKey(check, "allowBinary"))),
+	}, nil
+}
+
+// Files over the size limit are flagged as a whole, so their content isn't read at all. With the
+// check turned off, there's no limit.
+func contentSizeLimit(checks []configuredCheck) int64 {
+	for _, check := range checks {
+		if guard, ok := check.check.(fileGuardCheck); ok { return guard.maxSize }
+	}
+	return 0
+}
+
+func (check fileGuardCheck) CheckFile(file *diffFile, out *flagSink) {
+	if file.Change == ChangeDeleted { return }
+	// renames, copies, and mode changes which leave the content alone aren't adding anything
+	contentChanged := file.Change == ChangeAdded || file.Binary || len(file.Hunks) > 0
+	if !contentChanged { return }
+
+	if check.maxSize > 0 && file.Size > check.maxSize {
+		out.FlagAs(SeverityError, LargeFileFlag{
+			FileName: file.FileName,
+			Size: file.Size,
+			Limit: check.maxSize,
+		})
+	}
+
+	// a file which was already binary was flagged (or allowed) when it became binary
+	newlyBinary := file.Binary && !file.OldBinary
+	if newlyBinary && !matchesAnyGlob(check.allowBinary, file.FileName) {
+		out.FlagAs(SeverityWarning, BinaryFileFlag{
+			FileName: file.FileName,
+			Size: file.Size,
+			AllowedPaths: check.allowBinary,
+		})
+	}
+
+	if file.Attributes["filter"] == "lfs" && !file.LFSPointer {
+		out.FlagAs(SeverityError, LFSPointerFlag{
+			FileName: file.FileName,
+			Size: file.Size,
+		})
+	}
+}
+
+// Sizes are given as git does in its configuration: a number of bytes, optionally followed by
+// "k", "m", or "g" for kibibytes, mebibytes, or gibibytes.
+func parseByteSize(raw string) (int64, error) {
+	digits := strings.TrimSpace(raw)
+	multiplier := int64(1)
+	if len(digits) > 0 {
+		switch strings.ToLower(digits[len(digits)-1:]) {
+			case "k": multiplier = 1024
+			case "m": multiplier = 1024 * 1024
+			case "g": multiplier = 1024 * 1024 * 1024
+		}
+	}
+	if multiplier > 1 { digits = digits[:len(digits)-1] }
+
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("\"%s\" is not a size, such as \"500k\" or \"2m\"", raw)
+	}
+	return size * multiplier, nil
+}
+
+func formatByteSize(size int64) string {
+	units := []string{"KiB", "MiB", "GiB"}
+	if size < 1024 { return fmt.Sprintf("%d bytes", size) }
+	value := float64(size) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(units) - 1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,62 @@
+package checking
+
+import (
+	"fmt"
+	"strings"
+)
+
+type LineIndentFlag struct {
+	FileName string `json:"file"`
+	LineNumber uint `json:"line"`
+	FileIndents IndentKind `json:"fileIndents"`
+	LineIndents IndentKind `json:"lineIndents"`
+	LineContent string `json:"lineContent"`
+}
+
+func (flag LineIndentFlag) Message() string {
+	return fmt.Sprintf(
+		"line has indentation (%s) inconsistent with the rest of the file (%s)",
+		flag.LineIndents, flag.FileIndents,
+	)
+}
+
+func (flag LineIndentFlag) ContextMsg() string {
+	return ""
+}
+
+func (flag LineIndentFlag) Location() Location {
+	return Location{File: flag.FileName, Line: flag.LineNumber, Column: 1}
+}
+
+func (flag LineIndentFlag) FingerprintContent() string {
+	return flag.LineIndents.String() + "\x00" + normalizeFingerprintLine(flag.LineContent)
+}
+
+func (flag LineIndentFlag) HighlightedLine() (string, int, int) {
+	indentLength := len(flag.LineContent) - len(strings.TrimLeft(flag.LineContent, " \t"))
+	return flag.LineContent, 0, indentLength
+}
+
+type indentCheck struct {
+	noHooks
+}
+
+func (indentCheck) Name() string { return "indent" }
+
+func (indentCheck) Description() string {
+	return "added lines indented differently from the rest of the file"
+}
+
+func (indentCheck) DefaultSeverity() Severity { return SeverityError }
+
+func (indentCheck) CheckLine(file *diffFile, line *diffLine, out *flagSink) {
+	if !file.Indents.incompatibleWithLine(line.Indents) { return }
+
+	out.Flag(LineIndentFlag{
+		FileName: file.FileName,
+		LineNumber: line.LineNumber,
+		FileIndents: file.Indents,
+		LineIndents: line.Indents,
+		LineContent: line.Content,
+	})
+}
@@ -0,0 +1,252 @@
+package checking
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lorentzforces/check-changes/internal/config"
+	"github.com/lorentzforces/check-changes/internal/platform"
+)
+
+type KeywordPresenceFlag struct {
+	FileName string `json:"file"`
+	LineNumber uint `json:"line"`
+	Column uint `json:"column"`
+	Keyword string `json:"keyword"`
+	MatchedText string `json:"matchedText"`
+	LineContent string `json:"lineContent"`
+	CustomMessage string `json:"customMessage,omitempty"`
+}
+
+func (flag KeywordPresenceFlag) Message() string {
+	if len(flag.CustomMessage) > 0 {
+		return flag.CustomMessage
+	}
+	return fmt.Sprintf("line contains keyword \"%s\"", flag.Keyword)
+}
+
+func (flag KeywordPresenceFlag) ContextMsg() string {
+	return trimReportedLine(flag.LineContent)
+}
+
+func (flag KeywordPresenceFlag) Location() Location {
+	return Location{File: flag.FileName, Line: flag.LineNumber, Column: flag.Column}
+}
+
+func (flag KeywordPresenceFlag) FingerprintContent() string {
+	return flag.Keyword + "\x00" + normalizeFingerprintLine(flag.LineContent)
+}
+
+func (flag KeywordPresenceFlag) HighlightedLine() (string, int, int) {
+	start := byteOffsetOf(flag.LineContent, flag.Column)
+	return flag.LineContent, start, start + len(flag.MatchedText)
+}
+
+const errorKeywordsKey string = "keywords.error"
+const warnKeywordsKey string = "keywords.warning"
+
+var defaultErrorKeywords = []string{"NOCHECKIN"}
+var defaultWarnKeywords = []string{"TODO"}
+
+func keywordConfigDefaults() []config.Entry {
+	entries := make([]config.Entry, 0, len(defaultErrorKeywords) + len(defaultWarnKeywords))
+	for _, word := range defaultErrorKeywords {
+		entries = append(
+			entries,
+			config.Entry{Key: errorKeywordsKey, Value: word, Source: config.SourceDefault},
+		)
+	}
+	for _, word := range defaultWarnKeywords {
+		entries = append(
+			entries,
+			config.Entry{Key: warnKeywordsKey, Value: word, Source: config.SourceDefault},
+		)
+	}
+	return entries
+}
+
+// A keyword to search added lines for. Keywords are matched literally (on word boundaries) unless
+// IsRegex is set, in which case Pattern is used as a regular expression as-is.
+type keywordRule struct {
+	Name string
+	Pattern string
+	IsRegex bool
+	IgnoreCase bool
+	Severity Severity
+	Message string
+	regex *regexp.Regexp
+}
+
+func literalKeywordRule(word string, severity Severity) keywordRule {
+	return keywordRule{
+		Name: word,
+		Pattern: word,
+		Severity: severity,
+	}
+}
+
+func initKeywordRegex(rule keywordRule) (*regexp.Regexp, error) {
+	var buf strings.Builder
+	if rule.IgnoreCase { _, _ = buf.WriteString(`(?i)`) }
+
+	if rule.IsRegex {
+		_, _ = buf.WriteString(rule.Pattern)
+	} else {
+		// word boundaries only make sense next to word characters; "@todo" should still match
+		first, _ := utf8.DecodeRuneInString(rule.Pattern)
+		last, _ := utf8.DecodeLastRuneInString(rule.Pattern)
+		if isWordRune(first) { _, _ = buf.WriteString(`\b`) }
+		_, _ = buf.WriteString(regexp.QuoteMeta(rule.Pattern))
+		if isWordRune(last) { _, _ = buf.WriteString(`\b`) }
+	}
+
+	regex, err := regexp.Compile(buf.String())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid pattern for keyword \"%s\": %w", rule.Name, err)
+	}
+	return regex, nil
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+type keywordCheck struct {
+	noHooks
+	rules []keywordRule
+}
+
+var defaultKeywordCheck = mustKeywordCheck(defaultKeywordRules())
+
+func defaultKeywordRules() []keywordRule {
+	rules := make([]keywordRule, 0, len(defaultErrorKeywords) + len(defaultWarnKeywords))
+	for _, word := range defaultErrorKeywords {
+		rules = append(rules, literalKeywordRule(word, SeverityError))
+	}
+	for _, word := range defaultWarnKeywords {
+		rules = append(rules, literalKeywordRule(word, SeverityWarning))
+	}
+	return rules
+}
+
+func newKeywordCheck(rules []keywordRule) (keywordCheck, error) {
+	check := keywordCheck{rules: make([]keywordRule, 0, len(rules))}
+	for _, rule := range rules {
+		regex, err := initKeywordRegex(rule)
+		if err != nil { return keywordCheck{}, err }
+		rule.regex = regex
+		check.rules = append(check.rules, rule)
+	}
+	return check, nil
+}
+
+// Only for rules known to be valid ahead of time, like regexp.MustCompile.
+func mustKeywordCheck(rules []keywordRule) keywordCheck {
+	check, err := newKeywordCheck(rules)
+	platform.AssertNoErr(err)
+	return check
+}
+
+func (keywordCheck) Name() string { return "keyword" }
+
+func (keywordCheck) Description() string {
+	return "added lines containing a configured keyword (by default NOCHECKIN is an error and " +
+		"TODO is a warning)"
+}
+
+func (keywordCheck) DefaultSeverity() Severity { return SeverityError }
+
+// Keywords come from the simple keywords.error and keywords.warning lists, and from keyword
+// sections, which allow for more control:
+//
+//	[keyword "FIXME"]
+//		severity = error
+//		pattern = FIXME|XXX
+//		regex = true
+//		ignoreCase = true
+//		message = fix this before merging
+//
+// A keyword section with the same name as a listed keyword replaces it.
+func (keywordCheck) configure(settings config.Settings) (Check, error) {
+	rules := make([]keywordRule, 0)
+	for _, word := range nonEmpty(settings.Values(errorKeywordsKey)) {
+		rules = append(rules, literalKeywordRule(word, SeverityError))
+	}
+	for _, word := range nonEmpty(settings.Values(warnKeywordsKey)) {
+		rules = append(rules, literalKeywordRule(word, SeverityWarning))
+	}
+
+	for _, name := range settings.Subsections("keyword") {
+		rule, enabled, err := parseKeywordRule(settings, name)
+		if err != nil { return nil, err }
+
+		rules = slices.DeleteFunc(rules, func(existing keywordRule) bool {
+			return existing.Name == name
+		})
+		if enabled { rules = append(rules, rule) }
+	}
+
+	return newKeywordCheck(rules)
+}
+
+func parseKeywordRule(settings config.Settings, name string) (keywordRule, bool, error) {
+	key := func(option string) string { return "keyword." + name + "." + option }
+
+	enabled, err := settings.Bool(key("enabled"), true)
+	if err != nil { return keywordRule{}, false, err }
+
+	rule := literalKeywordRule(name, SeverityWarning)
+	if pattern := settings.String(key("pattern")); len(pattern) > 0 {
+		rule.Pattern = pattern
+	}
+	rule.Message = settings.String(key("message"))
+
+	rule.IsRegex, err = settings.Bool(key("regex"), false)
+	if err != nil { return keywordRule{}, false, err }
+	rule.IgnoreCase, err = settings.Bool(key("ignoreCase"), false)
+	if err != nil { return keywordRule{}, false, err }
+
+	if severitySetting, ok := settings.Get(key("severity")); ok {
+		rule.Severity, err = ParseSeverity(severitySetting.Value())
+		if err != nil {
+			return keywordRule{}, false, fmt.Errorf("%w (from %s)", err, severitySetting.Source)
+		}
+	}
+
+	return rule, enabled, nil
+}
+
+// Every keyword found on a line is flagged, not just the first, and so is every occurrence of each.
+func (check keywordCheck) CheckLine(file *diffFile, line *diffLine, out *flagSink) {
+	for _, rule := range check.rules {
+		for _, match := range rule.regex.FindAllStringIndex(line.Content, -1) {
+			// a pattern like "x*" matches nothing everywhere, which isn't a keyword
+			if match[0] == match[1] { continue }
+			out.FlagAs(
+				rule.Severity,
+				KeywordPresenceFlag{
+					FileName: file.FileName,
+					LineNumber: line.LineNumber,
+					Column: columnOf(line.Content, match[0]),
+					Keyword: rule.Name,
+					MatchedText: line.Content[match[0]:match[1]],
+					LineContent: line.Content,
+					CustomMessage: rule.Message,
+				},
+			)
+		}
+	}
+}
+
+// an empty value clears a keyword list, so it shouldn't end up as a keyword itself
+func nonEmpty(words []string) []string {
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		if len(word) > 0 { result = append(result, word) }
+	}
+	return result
+}
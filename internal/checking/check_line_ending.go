@@ -0,0 +1,106 @@
+package checking
+
+import (
+	"fmt"
+
+	"github.com/lorentzforces/check-changes/internal/config"
+)
+
+type LineEndingFlag struct {
+	FileName string `json:"file"`
+	LineNumber uint `json:"line"`
+	LineEnding LineEnding `json:"lineEnding"`
+	Expected LineEnding `json:"expected"`
+	// Set when the expected line ending comes from .gitattributes rather than the rest of the file.
+	FromAttributes bool `json:"fromAttributes"`
+	LineContent string `json:"lineContent"`
+}
+
+func (flag LineEndingFlag) Message() string {
+	if flag.FromAttributes {
+		return fmt.Sprintf(
+			"line ends in %s, but .gitattributes makes this a text file, which git stores with %s "+
+				"endings",
+			flag.LineEnding, flag.Expected,
+		)
+	}
+	return fmt.Sprintf(
+		"line ends in %s, while most of the file's lines end in %s",
+		flag.LineEnding, flag.Expected,
+	)
+}
+
+func (flag LineEndingFlag) ContextMsg() string {
+	return trimReportedLine(flag.LineContent)
+}
+
+func (flag LineEndingFlag) Location() Location {
+	// the line ending is just past the end of the line's content
+	column := columnOf(flag.LineContent, len(flag.LineContent))
+	return Location{File: flag.FileName, Line: flag.LineNumber, Column: column}
+}
+
+func (flag LineEndingFlag) FingerprintContent() string {
+	return flag.LineEnding.String() + "\x00" + normalizeFingerprintLine(flag.LineContent)
+}
+
+type lineEndingCheck struct {
+	noHooks
+	// Whether to go by the text and eol attributes in .gitattributes, where they're set.
+	useAttributes bool
+}
+
+var defaultLineEndingCheck = lineEndingCheck{useAttributes: true}
+
+func lineEndingConfigDefaults() []config.Entry {
+	return []config.Entry{{
+		Key: checkKey(defaultLineEndingCheck, "useAttributes"),
+		Value: "true",
+		Source: config.SourceDefault,
+	}}
+}
+
+func (lineEndingCheck) Name() string { return "line-ending" }
+
+func (lineEndingCheck) Description() string {
+	return "added lines whose line ending (CRLF or LF) differs from the rest of the file"
+}
+
+func (lineEndingCheck) DefaultSeverity() Severity { return SeverityWarning }
+
+func (check lineEndingCheck) configure(settings config.Settings) (Check, error) {
+	useAttributes, err := settings.Bool(checkKey(check, "useAttributes"), true)
+	if err != nil { return nil, err }
+	return lineEndingCheck{useAttributes: useAttributes}, nil
+}
+
+// The line ending every line of the file should have, and whether that was decided by the file's
+// attributes. Unless attributes say otherwise, it's whichever ending most of the file's lines
+// already have.
+func (check lineEndingCheck) expectedEnding(file *diffFile) (LineEnding, bool) {
+	if !check.useAttributes { return file.LineEnding, false }
+
+	text, eol := file.Attributes["text"], file.Attributes["eol"]
+	// "-text" (or "binary") means git leaves line endings alone
+	if text == "unset" { return LineEndingNone, true }
+	// text files are normalized to LF in the repository, whatever their endings when checked out
+	isText := text == "set" || text == "auto" || eol == "lf" || eol == "crlf"
+	if isText { return LineEndingLF, true }
+
+	return file.LineEnding, false
+}
+
+func (check lineEndingCheck) CheckLine(file *diffFile, line *diffLine, out *flagSink) {
+	if line.LineEnding == LineEndingNone { return }
+	expected, fromAttributes := check.expectedEnding(file)
+	if expected == LineEndingNone || line.LineEnding == expected { return }
+
+	out.Flag(LineEndingFlag{
+		FileName: file.FileName,
+		LineNumber: line.LineNumber,
+		LineEnding: line.LineEnding,
+		Expected: expected,
+		FromAttributes: fromAttributes,
+		LineContent: line.Content,
+	})
+}
@@ -0,0 +1,330 @@
+package checking
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lorentzforces/check-changes/internal/config"
+	"github.com/lorentzforces/check-changes/internal/platform"
+)
+
+// Secrets are never stored in the flag, since flags end up in logs, CI output, and the baseline
+// file. Only the line with each secret masked out is kept.
+type SecretFlag struct {
+	FileName string `json:"file"`
+	LineNumber uint `json:"line"`
+	// The secret spans from Column up to (but not including) EndColumn.
+	Column uint `json:"column"`
+	EndColumn uint `json:"endColumn"`
+	Rule string `json:"rule"`
+	Description string `json:"description"`
+	RedactedLine string `json:"redactedLine"`
+}
+
+func (flag SecretFlag) Message() string {
+	return fmt.Sprintf("line may contain a secret (%s)", flag.Description)
+}
+
+func (flag SecretFlag) ContextMsg() string {
+	return trimReportedLine(flag.RedactedLine)
+}
+
+func (flag SecretFlag) Location() Location {
+	return Location{File: flag.FileName, Line: flag.LineNumber, Column: flag.Column}
+}
+
+func (flag SecretFlag) FingerprintContent() string {
+	return flag.Rule + "\x00" + normalizeFingerprintLine(flag.RedactedLine)
+}
+
+func (flag SecretFlag) HighlightedLine() (string, int, int) {
+	start := byteOffsetOf(flag.RedactedLine, flag.Column)
+	end := byteOffsetOf(flag.RedactedLine, flag.EndColumn)
+	return flag.RedactedLine, start, end
+}
+
+// Each character of a secret is replaced by this, so that columns are the same in a redacted line
+// as in the original.
+const redactionChar = "*"
+
+const secretsAllowKey string = "secrets.allow"
+
+// A pattern for a kind of secret. If the pattern has a group named "secret", only that part of a
+// match is the secret; otherwise the whole match is. Matches whose secret is less random than
+// MinEntropy (in bits per character) are ignored, which weeds out placeholders and the like.
+type secretRule struct {
+	Name string
+	Pattern string
+	Description string
+	MinEntropy float64
+	// For secrets which span lines (like PEM private keys), a pattern for the line which ends the
+	// secret. Every added line after a match, up to that line, is secret as a whole.
+	BlockEnd string
+	regex *regexp.Regexp
+	secretGroup int
+	blockEndRegex *regexp.Regexp
+}
+
+var defaultSecretRules = []secretRule{
+	{
+		Name: "private-key",
+		Pattern: `-----BEGIN[A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`,
+		Description: "private key",
+		BlockEnd: `-----END[A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`,
+	},
+	{
+		Name: "aws-access-key",
+		Pattern: `\b(?P<secret>(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16})\b`,
+		Description: "AWS access key ID",
+	},
+	{
+		Name: "gcp-api-key",
+		Pattern: `\b(?P<secret>AIza[0-9A-Za-z_\-]{35})\b`,
+		Description: "Google Cloud API key",
+	},
+	{
+		Name: "github-token",
+		Pattern: `\b(?P<secret>(?:gh[pousr]|github_pat)_[0-9A-Za-z_]{36,})\b`,
+		Description: "GitHub token",
+	},
+	{
+		Name: "jwt",
+		Pattern: `\b(?P<secret>eyJ[0-9A-Za-z_\-]{5,}\.eyJ[0-9A-Za-z_\-]{5,}\.[0-9A-Za-z_\-]{10,})`,
+		Description: "JSON web token",
+	},
+	{
+		Name: "password-assignment",
+		// only quoted values, since an unquoted one is usually a variable; values which look like
+		// substitutions ("${PASSWORD}", "<password>", and so on) aren't secrets
+		Pattern: `(?i)(?:password|passwd|pwd)\w*["']?\s*(?::=|=>|[:=])\s*` +
+			`["'](?P<secret>[^"'\s$<{%][^"'\s]{3,})["']`,
+		Description: "hard-coded password",
+	},
+	{
+		Name: "high-entropy-assignment",
+		Pattern: `(?i)(?:secret|token|api_?key|access_?key|auth|credential|private_?key)\w*` +
+			`["']?\s*(?::=|=>|[:=])\s*["'](?P<secret>[0-9A-Za-z+/=_\-.]{16,})["']`,
+		Description: "random-looking value assigned to a secret-sounding name",
+		MinEntropy: 3.5,
+	},
+}
+
+func initSecretRule(rule secretRule) (secretRule, error) {
+	regex, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return secretRule{}, fmt.Errorf(
+			"Invalid pattern for secret rule \"%s\": %w",
+			rule.Name, err,
+		)
+	}
+	rule.regex = regex
+	rule.secretGroup = max(regex.SubexpIndex("secret"), 0)
+	if len(rule.BlockEnd) > 0 {
+		rule.blockEndRegex, err = regexp.Compile(rule.BlockEnd)
+		if err != nil {
+			return secretRule{}, fmt.Errorf(
+				"Invalid block end pattern for secret rule \"%s\": %w",
+				rule.Name, err,
+			)
+		}
+	}
+	return rule, nil
+}
+
+type secretCheck struct {
+	noHooks
+	rules []secretRule
+	// Files which are allowed to contain secrets, such as test fixtures.
+	allowedPaths []string
+}
+
+var defaultSecretCheck = mustSecretCheck(defaultSecretRules, nil)
+
+func newSecretCheck(rules []secretRule, allowedPaths []string) (secretCheck, error) {
+	check := secretCheck{
+		rules: make([]secretRule, 0, len(rules)),
+		allowedPaths: allowedPaths,
+	}
+	for _, rule := range rules {
+		rule, err := initSecretRule(rule)
+		if err != nil { return secretCheck{}, err }
+		check.rules = append(check.rules, rule)
+	}
+	return check, nil
+}
+
+func mustSecretCheck(rules []secretRule, allowedPaths []string) secretCheck {
+	check, err := newSecretCheck(rules, allowedPaths)
+	platform.AssertNoErr(err)
+	return check
+}
+
+func (secretCheck) Name() string { return "secret" }
+
+func (secretCheck) Description() string {
+	return "added lines containing what look like private keys, access keys, tokens, or passwords"
+}
+
+func (secretCheck) DefaultSeverity() Severity { return SeverityError }
+
+// Rules can be added, or the default rules changed or turned off, with secret sections:
+//
+//	[secret "internal-token"]
+//		pattern = itk_(?P<secret>[0-9a-f]{32})
+//		description = internal service token
+//		minEntropy = 3
+//	[secret "jwt"]
+//		enabled = false
+//
+// A rule for a secret which spans lines also gives a blockEnd pattern, for the line it ends on.
+//
+// Paths which may contain secrets (as globs, like .gitignore patterns) are listed in
+// secrets.allow, which may be given multiple times.
+func (secretCheck) configure(settings config.Settings) (Check, error) {
+	rules := slices.Clone(defaultSecretRules)
+	for _, name := range settings.Subsections("secret") {
+		key := func(option string) string { return "secret." + name + "." + option }
+
+		index := slices.IndexFunc(rules, func(rule secretRule) bool { return rule.Name == name })
+		rule := secretRule{Name: name, Description: name}
+		if index >= 0 { rule = rules[index] }
+
+		if pattern := settings.String(key("pattern")); len(pattern) > 0 { rule.Pattern = pattern }
+		if description := settings.String(key("description")); len(description) > 0 {
+			rule.Description = description
+		}
+		if blockEnd := settings.String(key("blockEnd")); len(blockEnd) > 0 { rule.BlockEnd = blockEnd }
+		if minEntropySetting, ok := settings.Get(key("minEntropy")); ok {
+			minEntropy, err := strconv.ParseFloat(minEntropySetting.Value(), 64)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Invalid value for %s: %w (from %s)",
+					key("minEntropy"), err, minEntropySetting.Source,
+				)
+			}
+			rule.MinEntropy = minEntropy
+		}
+		if len(rule.Pattern) == 0 {
+			return nil, fmt.Errorf("Secret rule \"%s\" has no pattern", name)
+		}
+
+		enabled, err := settings.Bool(key("enabled"), true)
+		if err != nil { return nil, err }
+		if index >= 0 { rules = slices.Delete(rules, index, index + 1) }
+		if enabled { rules = append(rules, rule) }
+	}
+
+	return newSecretCheck(rules, nonEmpty(settings.Values(secretsAllowKey)))
+}
+
+type secretHit struct {
+	rule *secretRule
+	start int
+	end int
+}
+
+func (check secretCheck) redactLines(file *diffFile, out *flagSink) {
+	if matchesAnyGlob(check.allowedPaths, file.FileName) { return }
+
+	// the lines of a multi-line secret are masked as a whole, until the line which ends it
+	var blockEnd *regexp.Regexp
+	for k := range file.ChangedLines {
+		line := &file.ChangedLines[k]
+		if blockEnd != nil {
+			if !blockEnd.MatchString(line.Content) {
+				line.Content = maskLine(line.Content)
+				continue
+			}
+			blockEnd = nil
+		}
+		blockEnd = check.redactLine(file, line, out)
+	}
+}
+
+// A secret found by more than one rule is only flagged once, by the first rule to find it. Every
+// secret on the line is then redacted from it, so that no other check (or flag) ever sees one.
+// Returns the pattern for the end of a multi-line secret which the line starts, if any.
+func (check secretCheck) redactLine(
+	file *diffFile,
+	line *diffLine,
+	out *flagSink,
+) *regexp.Regexp {
+	hits := make([]secretHit, 0)
+	for i := range check.rules {
+		rule := &check.rules[i]
+		for _, match := range rule.regex.FindAllStringSubmatchIndex(line.Content, -1) {
+			start, end := match[2 * rule.secretGroup], match[2 * rule.secretGroup + 1]
+			if start < 0 || start == end { continue }
+			if shannonEntropy(line.Content[start:end]) < rule.MinEntropy { continue }
+
+			overlaps := slices.ContainsFunc(hits, func(hit secretHit) bool {
+				return start < hit.end && hit.start < end
+			})
+			if !overlaps { hits = append(hits, secretHit{rule: rule, start: start, end: end}) }
+		}
+	}
+	if len(hits) == 0 { return nil }
+	slices.SortFunc(hits, func(a, b secretHit) int { return a.start - b.start })
+
+	var redacted strings.Builder
+	previousEnd := 0
+	for _, hit := range hits {
+		_, _ = redacted.WriteString(line.Content[previousEnd:hit.start])
+		secretLength := utf8.RuneCountInString(line.Content[hit.start:hit.end])
+		_, _ = redacted.WriteString(strings.Repeat(redactionChar, secretLength))
+		previousEnd = hit.end
+	}
+	_, _ = redacted.WriteString(line.Content[previousEnd:])
+
+	for _, hit := range hits {
+		out.Flag(SecretFlag{
+			FileName: file.FileName,
+			LineNumber: line.LineNumber,
+			Column: columnOf(line.Content, hit.start),
+			EndColumn: columnOf(line.Content, hit.end),
+			Rule: hit.rule.Name,
+			Description: hit.rule.Description,
+			RedactedLine: redacted.String(),
+		})
+	}
+
+	var blockEnd *regexp.Regexp
+	for _, hit := range hits {
+		if hit.rule.blockEndRegex == nil { continue }
+		// a block which ends on the same line doesn't go on to the next ones
+		blockEnd = hit.rule.blockEndRegex
+		if blockEnd.MatchString(line.Content[hit.end:]) { blockEnd = nil }
+	}
+	line.Content = redacted.String()
+	return blockEnd
+}
+
+// Masks a line's content entirely, apart from whitespace at either end.
+func maskLine(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if len(trimmed) == 0 { return content }
+	start := strings.Index(content, trimmed)
+	masked := strings.Repeat(redactionChar, utf8.RuneCountInString(trimmed))
+	return content[:start] + masked + content[start + len(trimmed):]
+}
+
+// The average number of bits of information per byte of text.
+func shannonEntropy(text string) float64 {
+	if len(text) == 0 { return 0 }
+	counts := make(map[byte]int)
+	for i := 0; i < len(text); i++ {
+		counts[text[i]]++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		frequency := float64(count) / float64(len(text))
+		entropy -= frequency * math.Log2(frequency)
+	}
+	return entropy
+}
@@ -0,0 +1,45 @@
+package checking
+
+import (
+	"fmt"
+)
+
+type StashEntryFlag struct {
+	Number uint `json:"number"`
+	FullLine string `json:"fullLine"`
+}
+
+func (flag StashEntryFlag) Message() string {
+	return fmt.Sprintf("Stash entry {%d} has stashed changes from your current branch", flag.Number)
+}
+
+func (flag StashEntryFlag) ContextMsg() string {
+	return flag.FullLine
+}
+
+func (flag StashEntryFlag) Location() Location {
+	return Location{}
+}
+
+type stashCheck struct {
+	noHooks
+}
+
+func (stashCheck) Name() string { return "stash" }
+
+func (stashCheck) Description() string {
+	return "stash entries made on the current branch (possibly forgotten changes)"
+}
+
+func (stashCheck) DefaultSeverity() Severity { return SeverityWarning }
+
+func (stashCheck) CheckRepo(data *checkData, out *flagSink) {
+	for _, entry := range data.StashEntries {
+		if entry.Branch == data.CurrentBranch {
+			out.Flag(StashEntryFlag{
+				Number: entry.Number,
+				FullLine: entry.RawString,
+			})
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package checking
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/config"
+)
+
+type TrailingWhitespaceFlag struct {
+	FileName string `json:"file"`
+	LineNumber uint `json:"line"`
+	// The whitespace spans from Column up to (but not including) EndColumn.
+	Column uint `json:"column"`
+	EndColumn uint `json:"endColumn"`
+	WhitespaceOnly bool `json:"whitespaceOnly"`
+	LineContent string `json:"lineContent"`
+}
+
+func (flag TrailingWhitespaceFlag) Message() string {
+	if flag.WhitespaceOnly { return "line contains only whitespace" }
+	return "line has trailing whitespace"
+}
+
+// The whitespace itself can't be seen, so it's described instead.
+func (flag TrailingWhitespaceFlag) ContextMsg() string {
+	_, start, end := flag.HighlightedLine()
+	return fmt.Sprintf(
+		"%s at columns %d-%d",
+		strconv.Quote(flag.LineContent[start:end]), flag.Column, flag.EndColumn - 1,
+	)
+}
+
+func (flag TrailingWhitespaceFlag) Location() Location {
+	return Location{File: flag.FileName, Line: flag.LineNumber, Column: flag.Column}
+}
+
+func (flag TrailingWhitespaceFlag) FingerprintContent() string {
+	kind := "trailing"
+	if flag.WhitespaceOnly { kind = "only" }
+	return kind + "\x00" + normalizeFingerprintLine(flag.LineContent)
+}
+
+func (flag TrailingWhitespaceFlag) HighlightedLine() (string, int, int) {
+	start := byteOffsetOf(flag.LineContent, flag.Column)
+	end := byteOffsetOf(flag.LineContent, flag.EndColumn)
+	return flag.LineContent, start, end
+}
+
+// What the check looks for in a file, which depends on the file's path.
+type whitespaceRules struct {
+	Enabled bool
+	// Whether to flag lines which contain only whitespace.
+	BlankLines bool
+	// Whether to allow two or more trailing spaces, which make a line break in Markdown.
+	AllowHardBreaks bool
+}
+
+var defaultWhitespaceRules = whitespaceRules{Enabled: true, BlankLines: true}
+
+// Rules for the files matching a glob. Options which a section doesn't set are left to other
+// matching sections, or to the defaults.
+type whitespaceSection struct {
+	Glob string
+	Enabled *bool
+	BlankLines *bool
+	AllowHardBreaks *bool
+}
+
+type trailingWhitespaceCheck struct {
+	noHooks
+	sections []whitespaceSection
+}
+
+func whitespaceConfigDefaults() []config.Entry {
+	return []config.Entry{
+		{ Key: "whitespace.*.md.allowHardBreaks", Value: "true", Source: config.SourceDefault },
+		{ Key: "whitespace.*.markdown.allowHardBreaks", Value: "true", Source: config.SourceDefault },
+	}
+}
+
+func (trailingWhitespaceCheck) Name() string { return "trailing-whitespace" }
+
+func (trailingWhitespaceCheck) Description() string {
+	return "added lines with trailing whitespace, or which contain only whitespace"
+}
+
+func (trailingWhitespaceCheck) DefaultSeverity() Severity { return SeverityWarning }
+
+// Rules are set per file glob (like a .gitignore pattern) in whitespace sections:
+//
+//	[whitespace "*.md"]
+//		allowHardBreaks = true
+//	[whitespace "testdata/"]
+//		enabled = false
+//	[whitespace "*.txt"]
+//		blankLines = false
+//
+// Where several sections match a file and set the same option, the longest glob wins, since it's
+// likely the most specific.
+func (trailingWhitespaceCheck) configure(settings config.Settings) (Check, error) {
+	check := trailingWhitespaceCheck{}
+	for _, glob := range settings.Subsections("whitespace") {
+		section := whitespaceSection{Glob: glob}
+		options := []struct{
+			name string
+			value **bool
+		} {
+			{ "enabled", &section.Enabled },
+			{ "blankLines", &section.BlankLines },
+			{ "allowHardBreaks", &section.AllowHardBreaks },
+		}
+		for _, option := range options {
+			key := "whitespace." + glob + "." + option.name
+			if _, isSet := settings.Get(key); !isSet { continue }
+			value, err := settings.Bool(key, false)
+			if err != nil { return nil, err }
+			*option.value = &value
+		}
+		check.sections = append(check.sections, section)
+	}
+
+	slices.SortStableFunc(check.sections, func(a, b whitespaceSection) int {
+		return cmp.Compare(len(a.Glob), len(b.Glob))
+	})
+	return check, nil
+}
+
+func (check trailingWhitespaceCheck) rulesFor(filePath string) whitespaceRules {
+	rules := defaultWhitespaceRules
+	// sections are sorted by increasing specificity, so later ones override earlier ones
+	for _, section := range check.sections {
+		if !matchesGlob(section.Glob, filePath) { continue }
+		if section.Enabled != nil { rules.Enabled = *section.Enabled }
+		if section.BlankLines != nil { rules.BlankLines = *section.BlankLines }
+		if section.AllowHardBreaks != nil { rules.AllowHardBreaks = *section.AllowHardBreaks }
+	}
+	return rules
+}
+
+func (check trailingWhitespaceCheck) CheckLine(file *diffFile, line *diffLine, out *flagSink) {
+	// a carriage return is part of a line ending, not trailing whitespace
+	content := strings.TrimSuffix(line.Content, "\r")
+	trimmed := strings.TrimRight(content, " \t")
+	if len(trimmed) == len(content) { return }
+
+	rules := check.rulesFor(file.FileName)
+	if !rules.Enabled { return }
+
+	whitespaceOnly := len(trimmed) == 0
+	if whitespaceOnly && !rules.BlankLines { return }
+	trailing := content[len(trimmed):]
+	isHardBreak := len(trailing) >= 2 && strings.Trim(trailing, " ") == ""
+	if !whitespaceOnly && rules.AllowHardBreaks && isHardBreak { return }
+
+	out.Flag(TrailingWhitespaceFlag{
+		FileName: file.FileName,
+		LineNumber: line.LineNumber,
+		Column: columnOf(content, len(trimmed)),
+		EndColumn: columnOf(content, len(content)),
+		WhitespaceOnly: whitespaceOnly,
+		LineContent: line.Content,
+	})
+}
@@ -2,105 +2,153 @@ package checking
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/lorentzforces/check-changes/internal/config"
 	"github.com/lorentzforces/check-changes/internal/git"
-	"github.com/lorentzforces/check-changes/internal/platform"
 )
 
-func CheckChanges(diffRev string) (CheckReport, error) {
-	checkData, err := gatherState(diffRev)
+func CheckChanges(
+	ctx context.Context,
+	gitClient *git.Client,
+	diffRev string,
+	opts *config.Opts,
+) (CheckReport, error) {
+	report, repoRoot, err := collectFindings(ctx, gitClient, diffRev, opts)
 	if err != nil {
 		return CheckReport{}, err
 	}
 
-	return reportChecks(checkData), nil
+	baseline, err := readBaselineFile(baselinePath(repoRoot, opts))
+	if err != nil {
+		return CheckReport{}, err
+	}
+	applyBaseline(&report, baseline)
+	report.sort()
+
+	return report, nil
 }
 
-type CheckReport struct {
-	Errors []CheckFlag
-	Warnings []CheckFlag
+// Run every check, and apply any suppressions. Also returns the repository root.
+func collectFindings(
+	ctx context.Context,
+	gitClient *git.Client,
+	diffRev string,
+	opts *config.Opts,
+) (CheckReport, string, error) {
+	checks, err := configureChecks(opts.Settings)
+	if err != nil {
+		return CheckReport{}, "", err
+	}
+
+	checkData, err := gatherState(ctx, gitClient, diffRev, contentSizeLimit(checks))
+	if err != nil {
+		return CheckReport{}, "", err
+	}
+
+	return findingsFor(checkData, checks, opts), checkData.RepoRoot, nil
 }
 
-type CheckFlag interface {
-	Message() string
-	ContextMsg() string
+func findingsFor(data checkData, checks []configuredCheck, opts *config.Opts) CheckReport {
+	// the baseline file quotes the messages of flags, which may well get flagged themselves
+	baselineFile := baselinePath(data.RepoRoot, opts)
+	data.Files = slices.DeleteFunc(slices.Clone(data.Files), func(file diffFile) bool {
+		return filepath.Join(data.RepoRoot, file.FileName) == baselineFile
+	})
+
+	report := runChecks(data, checks)
+	applySuppressions(&report, data.Files, opts.ReportUnusedSuppressions)
+	return report
 }
 
-type StashEntryFlag struct {
-	Number uint
-	FullLine string
+type CheckReport struct {
+	Findings []Finding
+	// Findings which were suppressed by directives in the files they were found in.
+	Suppressed []Finding
+	// Findings which were accepted in the baseline file.
+	Baselined []Finding
 }
 
-func (flag StashEntryFlag) Message() string {
-	return fmt.Sprintf("Stash entry {%d} has stashed changes from your current branch", flag.Number)
+// Findings of the given severity, in report order.
+func (report CheckReport) WithSeverity(severity Severity) []Finding {
+	matching := make([]Finding, 0)
+	for _, finding := range report.Findings {
+		if finding.Severity == severity { matching = append(matching, finding) }
+	}
+	return matching
 }
 
-func (flag StashEntryFlag) ContextMsg() string {
-	return flag.FullLine
+func (report CheckReport) HasErrors() bool {
+	return len(report.WithSeverity(SeverityError)) > 0
 }
 
-type LineIndentFlag struct {
-	FileName string
-	LineNumber uint
-	FileIndents IndentKind
-	LineIndents IndentKind
+func (report *CheckReport) sort() {
+	for _, findings := range [][]Finding{report.Findings, report.Suppressed, report.Baselined} {
+		slices.SortStableFunc(findings, CompareFindings)
+	}
 }
 
-func (flag LineIndentFlag) Message() string {
-	return fmt.Sprintf(
-		"%s:%d | line has indentation (%s) inconsistent with the rest of the file (%s)",
-		flag.FileName, flag.LineNumber, flag.FileIndents, flag.LineIndents,
+// The default order of findings: by file path, then position in the file, then check name.
+// Findings which aren't in a file come first.
+func CompareFindings(a, b Finding) int {
+	aLocation, bLocation := a.Flag.Location(), b.Flag.Location()
+	return cmp.Or(
+		cmp.Compare(aLocation.File, bLocation.File),
+		cmp.Compare(aLocation.Line, bLocation.Line),
+		cmp.Compare(aLocation.Column, bLocation.Column),
+		cmp.Compare(a.Check, b.Check),
+		cmp.Compare(a.Flag.Message(), b.Flag.Message()),
 	)
 }
 
-func (flag LineIndentFlag) ContextMsg() string {
-	return ""
+// A flag raised by a check, along with the name of that check and the severity it was raised at.
+type Finding struct {
+	Check string
+	Severity Severity
+	Flag CheckFlag
 }
 
-type KeywordPresenceFlag struct {
-	FileName string
-	LineNumber uint
-	Keyword string
-	LineContent string
+// Each flag type is a struct whose fields are the structured details of that flag, suitable for
+// serializing.
+type CheckFlag interface {
+	// A description of the issue, not including its location.
+	Message() string
+	ContextMsg() string
+	// Where the issue was found. Issues which aren't in a file have an empty location.
+	Location() Location
 }
 
-func (flag KeywordPresenceFlag) Message() string {
-	return fmt.Sprintf(
-		"%s:%d | line contains keyword \"%s\"",
-		flag.FileName, flag.LineNumber, flag.Keyword,
-	)
+// Flags about a specific part of a line can say which part, so that it can be highlighted. Start
+// and end are byte offsets into the returned line.
+type LineHighlighter interface {
+	HighlightedLine() (line string, start int, end int)
 }
 
-func (flag KeywordPresenceFlag) ContextMsg() string {
-	return trimReportedLine(flag.LineContent)
+// A position in a file. Line and column numbers start from 1; zero means not applicable.
+type Location struct {
+	File string
+	Line uint
+	Column uint
 }
 
 type checkData struct {
+	RepoRoot string
 	CurrentBranch string
 	Files []diffFile
 	StashEntries []stashEntry
 }
 
-type diffFile struct {
-	FileName string
-	Indents IndentKind
-	ChangedLines []diffLine
-}
-
-type diffLine struct {
-	LineNumber uint
-	Indents IndentKind
-	Content string
-}
-
 type IndentKind int
 const (
 	IndentUnknown IndentKind = iota
@@ -116,8 +164,11 @@ func (ik IndentKind) String() string {
 		case IndentSpace: return "IndentSpace"
 		case IndentMixedLine: return "IndentMixedLine"
 	}
-	platform.Assert(false, fmt.Sprintf("Invalid IndentKind value provided: %d", ik))
-	panic("INVALID STATE: INVALID IndentKind VALUE PROVIDED")
+	return fmt.Sprintf("IndentKind(%d)", ik)
+}
+
+func (ik IndentKind) MarshalText() ([]byte, error) {
+	return []byte(ik.String()), nil
 }
 
 func (ik IndentKind) incompatibleWithLine(lineIndent IndentKind) bool {
@@ -134,36 +185,160 @@ type stashEntry struct {
 	RawString string
 }
 
-func gatherState(diffRev string) (checkData, error) {
-	repoRoot, err := git.RepoRoot()
+func gatherState(
+	ctx context.Context,
+	gitClient *git.Client,
+	diffRev string,
+	maxContentSize int64,
+) (checkData, error) {
+	repoRoot, err := gitClient.RepoRoot(ctx)
 	if err != nil {
 		return checkData{}, err
 	}
 
-	checkData := checkData{}
-	checkData.CurrentBranch = git.CurrentBranch()
+	checkData := checkData{RepoRoot: repoRoot}
+	checkData.CurrentBranch, err = gitClient.CurrentBranch(ctx)
+	if err != nil {
+		return checkData, err
+	}
 
-	stashEntries, err := parseStashEntries(git.StashEntries())
-	platform.FailOnErr(err)
+	rawStashEntries, err := gitClient.StashEntries(ctx)
+	if err != nil {
+		return checkData, err
+	}
+	stashEntries, err := parseStashEntries(rawStashEntries)
+	if err != nil {
+		return checkData, err
+	}
 	checkData.StashEntries = stashEntries
 
-	rawDiffLines := git.Diff(diffRev)
+	rawDiffLines, err := gitClient.Diff(ctx, diffRev)
+	if err != nil {
+		return checkData, err
+	}
+
+	// the diff is of the index, so analyze the staged content of each file rather than whatever
+	// happens to be on disk; this way partially-staged files are judged by what will be committed
+	oldRev := diffRev
+	if len(oldRev) == 0 { oldRev = "HEAD" }
+	diffFiles, err := gatherFiles(ctx, gitClient, rawDiffLines, oldRev, "", maxContentSize)
+	if err != nil {
+		return checkData, err
+	}
+	checkData.Files = diffFiles
+
+	return checkData, nil
+}
+
+// Parse a diff from oldRev, and analyze the full content of each file in it as of contentRev (or
+// as staged in the index, if contentRev is empty). Files larger than maxContentSize (unless it's
+// zero) are not read.
+func gatherFiles(
+	ctx context.Context,
+	gitClient *git.Client,
+	rawDiffLines []string,
+	oldRev string,
+	contentRev string,
+	maxContentSize int64,
+) ([]diffFile, error) {
+	diffFiles, err := parseDiffLines(rawDiffLines)
+	if err != nil {
+		return nil, err
+	}
+	overLimit := func(blob git.Blob) bool {
+		return maxContentSize > 0 && blob.Size > maxContentSize
+	}
 
-	diffFiles := parseDiffLines(rawDiffLines)
-	platform.AssertNoErr(err)
+	objectNames := make([]string, len(diffFiles))
+	// binary files which already existed are looked at as they were, to tell whether they were
+	// binary before the change too
+	changedBinaries := make([]int, 0)
+	oldObjectNames := make([]string, 0)
+	for i, diffFile := range diffFiles {
+		objectNames[i] = contentRev + ":" + diffFile.FileName
+		if diffFile.Binary && diffFile.Change != ChangeAdded && diffFile.Change != ChangeDeleted {
+			changedBinaries = append(changedBinaries, i)
+			oldObjectNames = append(oldObjectNames, oldRev + ":" + diffFile.OldFileName)
+		}
+	}
+	sizes, err := gitClient.CatFileSizes(ctx, slices.Concat(objectNames, oldObjectNames))
+	if err != nil {
+		return nil, err
+	}
 
+	// binary files can't be analyzed line by line, and may well be large, so they aren't read;
+	// neither are files over the size limit, which are only checked as a whole
+	textFiles := make([]int, 0, len(diffFiles))
+	textObjectNames := make([]string, 0, len(diffFiles))
 	for i := range diffFiles {
-		diffFile := &diffFiles[i]
-		realFilePath := filepath.Join(repoRoot, diffFile.FileName)
-		file, err := os.Open(realFilePath)
-		platform.AssertNoErr(err)
+		if sizes[i].Missing { continue } // deleted files have nothing to analyze
+		diffFiles[i].Size = sizes[i].Size
+		if diffFiles[i].Binary { continue }
+		if overLimit(sizes[i]) {
+			diffFiles[i].TooLarge = true
+			continue
+		}
+		textFiles = append(textFiles, i)
+		textObjectNames = append(textObjectNames, objectNames[i])
+	}
+	oldBinaries := make([]int, 0, len(changedBinaries))
+	for j, i := range changedBinaries {
+		oldSize := sizes[len(diffFiles) + j]
+		if oldSize.Missing { continue }
+		// an old version too large to read is most likely binary as well
+		if overLimit(oldSize) {
+			diffFiles[i].OldBinary = true
+			continue
+		}
+		oldBinaries = append(oldBinaries, i)
+		textObjectNames = append(textObjectNames, oldObjectNames[j])
+	}
+	blobs, err := gitClient.CatFileBatch(ctx, textObjectNames)
+	if err != nil {
+		return nil, err
+	}
 
-		populateFileInfo(diffFile, file)
-		file.Close()
+	for j, i := range textFiles {
+		if blobs[j].Missing { continue }
+		populateFileInfo(&diffFiles[i], bytes.NewReader(blobs[j].Content))
+		diffFiles[i].LFSPointer = isLFSPointer(blobs[j].Content)
+	}
+	for j, i := range oldBinaries {
+		oldBlob := blobs[len(textFiles) + j]
+		diffFiles[i].OldBinary = !oldBlob.Missing && looksBinary(oldBlob.Content)
 	}
-	checkData.Files = diffFiles
 
-	return checkData, nil
+	// attributes can only be read as of the index, even when the content is from a commit
+	paths := make([]string, len(diffFiles))
+	for i, diffFile := range diffFiles {
+		paths[i] = diffFile.FileName
+	}
+	attributes, err := gitClient.CheckAttr(ctx, gitAttributes, paths)
+	if err != nil {
+		return nil, err
+	}
+	for i := range diffFiles {
+		diffFiles[i].Attributes = attributes[diffFiles[i].FileName]
+	}
+	return diffFiles, nil
+}
+
+// The git attributes which checks make use of.
+var gitAttributes = []string{"text", "eol", "filter"}
+
+// Git LFS replaces the content of the files it manages with a small pointer file, which always
+// starts with its spec version. See https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1\n"
+
+func isLFSPointer(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(lfsPointerPrefix))
+}
+
+// Git considers content binary if there's a NUL byte anywhere near its start.
+const binaryCheckLength = 8000
+
+func looksBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binaryCheckLength)], 0) >= 0
 }
 
 func parseStashEntries(rawEntries []string) ([]stashEntry, error) {
@@ -178,7 +353,7 @@ func parseStashEntries(rawEntries []string) ([]stashEntry, error) {
 	return entries, nil
 }
 
-var stashParseError = fmt.Errorf("An error was encountered while parsing a stash entry string")
+var ErrStashParse = errors.New("An error was encountered while parsing a stash entry string")
 
 // format: "stash@{N}: [WIP on|On] branchName:" followed by stuff we don't care about
 // CAPTURE GROUPS (submatches) number: 1, branch: 3
@@ -190,12 +365,14 @@ func parseStashEntry(rawEntry string) (stashEntry, error) {
 			"Malformed input: output of 'git stash list' was unparseable: \"%s\"",
 			rawEntry,
 		)
-		return stashEntry{}, errors.Join(stashParseError, err)
+		return stashEntry{}, errors.Join(ErrStashParse, err)
 	}
 
 	rawNumber := matches[1]
 	number, err := strconv.ParseUint(rawNumber, 10, 64)
-	platform.AssertNoErr(err)
+	if err != nil {
+		return stashEntry{}, errors.Join(ErrStashParse, err)
+	}
 	return stashEntry{
 			Number: uint(number),
 			Branch: matches[3],
@@ -204,114 +381,57 @@ func parseStashEntry(rawEntry string) (stashEntry, error) {
 		nil
 }
 
-var diffParseError = fmt.Errorf("An error was encoutnered while parsing diff output")
-
-var resultFileRegex = regexp.MustCompile(`b/(\S+)\z`)
-var extendedHeaderRegex = regexp.MustCompile(`\A(index|mode|new file mode|deleted file mode)`)
-var chunkHeaderLineNumRegex = regexp.MustCompile(`\b+(\d+),`)
-
-func parseDiffLines(rawLines []string) []diffFile {
-	files := make(map[string]*diffFile, 0)
-	fileName := ""
-	lastHeaderHeader := -1
-	lastChunkHeader := -1
-	newFileLineNumber := -1
-
-	for i, rawLine := range rawLines {
-		isHeaderHeader := strings.HasPrefix(rawLine, "diff --git")
-		if isHeaderHeader {
-			matches := resultFileRegex.FindStringSubmatch(rawLine)
-			platform.Assert(
-				matches != nil,
-				fmt.Sprintf("Result file regex did not find a target file name on line %d", i),
-			)
-
-			targetFile := matches[1]
-			if targetFile == "/dev/null" {
-				continue // impossible for there to be added lines here
-			}
-
-			lastHeaderHeader = i
-			fileName = targetFile
-			files[fileName] = &diffFile{
-				FileName: fileName,
-				Indents: IndentUnknown,
-				ChangedLines: make([]diffLine, 0),
-			}
-			continue
-		}
-
-		isExtendedHeader := extendedHeaderRegex.MatchString(rawLine)
-		if isExtendedHeader {
-			continue
-		}
+// do filesystem-related things with a diffFile
+func populateFileInfo(diffFile *diffFile, file io.Reader) {
+	input := bufio.NewScanner(file)
+	input.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineLength)
 
-		isChunkHeader := strings.HasPrefix(rawLine, "@@")
-		if isChunkHeader {
-			lastChunkHeader = i
-			matches := chunkHeaderLineNumRegex.FindStringSubmatch(rawLine)
-			if matches == nil {
-				// chunk is removed lines only
-				continue
+	// The file's line ending is decided by the lines which were already there, since the added
+	// lines are the ones being judged. Files made up only of added lines go by all of them.
+	addedLines := make(map[uint]struct{}, len(diffFile.ChangedLines))
+	for _, line := range diffFile.ChangedLines {
+		addedLines[line.LineNumber] = struct{}{}
+	}
+	lfCount, crlfCount := 0, 0
+	addedLFCount, addedCRLFCount := 0, 0
+	// lines are split as usual, but their endings are counted on the way
+	splitLineNumber := uint(0)
+	input.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if advance > 0 { splitLineNumber++ }
+		if advance > 0 && data[advance-1] == '\n' {
+			_, added := addedLines[splitLineNumber]
+			isCRLF := advance >= 2 && data[advance-2] == '\r'
+			switch {
+				case added && isCRLF: addedCRLFCount++
+				case added: addedLFCount++
+				case isCRLF: crlfCount++
+				default: lfCount++
 			}
-			lineNumber, err := strconv.Atoi(matches[1])
-			platform.AssertNoErr(err)
-			newFileLineNumber = lineNumber
-
-			continue
-		}
-
-		isHeaderLine := lastHeaderHeader < i && lastChunkHeader < lastHeaderHeader
-		if isHeaderLine {
-			continue
 		}
+		return advance, token, err
+	})
 
-		lineRunes := []rune(rawLine)
-		firstChar := lineRunes[0]
-		if firstChar == ' ' {
-			newFileLineNumber++
-			continue
-		}
-		if firstChar == '-' || firstChar == '\\' {
-			continue
+	fileIndents := IndentUnknown
+	lineNumber := uint(0)
+	for input.Scan() {
+		lineNumber++
+		line := input.Text()
+		if fileIndents == IndentUnknown {
+			fileIndents = whichLineIndents([]rune(line))
 		}
-		platform.Assert(
-			firstChar == '+',
-			fmt.Sprintf(
-				"Diff file content line did not start with one of [ -+\\], last file header: " +
-					"\"%s\" offending line is:\n\"%s\"",
-				fileName, rawLine,
-			),
-		)
-
-		line := diffLine{}
-		line.Content = rawLine
-		line.LineNumber = uint(newFileLineNumber)
-		line.Indents = whichLineIndents(lineRunes[1:])
-
-		currentFile := files[fileName]
-		currentFile.ChangedLines = append(currentFile.ChangedLines, line)
-		newFileLineNumber++
-	}
-
-	fileSlice := make([]diffFile, 0, len(files))
-	for _, file := range files {
-		fileSlice = append(fileSlice, *file)
+		diffFile.Suppressions = append(diffFile.Suppressions, parseSuppressions(line, lineNumber)...)
 	}
+	diffFile.Indents = fileIndents
 
-	return fileSlice
+	if lfCount == 0 && crlfCount == 0 { lfCount, crlfCount = addedLFCount, addedCRLFCount }
+	diffFile.LineEnding = LineEndingNone
+	if lfCount > crlfCount { diffFile.LineEnding = LineEndingLF }
+	if crlfCount > lfCount { diffFile.LineEnding = LineEndingCRLF }
 }
 
-// do filesystem-related things with a diffFile
-func populateFileInfo(diffFile *diffFile, file io.Reader) {
-	input := bufio.NewScanner(file)
-
-	fileIndents := IndentUnknown
-	for input.Scan() && fileIndents == IndentUnknown {
-		fileIndents = whichLineIndents([]rune(input.Text()))
-	}
-	diffFile.Indents = fileIndents
-}
+// Lines longer than this (minified files and the like) end analysis of the rest of the file.
+const maxLineLength = 16 * 1024 * 1024
 
 func whichLineIndents(line []rune) IndentKind {
 	indents := IndentUnknown
@@ -344,89 +464,10 @@ func accreteIndentKind(existing, observed IndentKind) IndentKind {
 	return IndentMixedLine
 }
 
-var errorKeywords = map[string]struct{} {
-	"NOCHECKIN": struct{}{},
-}
-var warnKeywords = map[string]struct{} {
-	"TODO": struct{}{},
-}
-
-func initKeywordRegex(wordSets... map[string]struct{}) *regexp.Regexp {
-	var buf strings.Builder
-	_, _ = buf.WriteString(`\b(`)
-
-	isFirst := true
-	for _, words := range wordSets {
-		for word, _ := range words {
-			if !isFirst { _, _ = buf.WriteString(`|`) }
-			isFirst = false
-			_, _ = buf.WriteString(word)
-		}
-	}
-
-	_, _ = buf.WriteString(`)\b`)
-	return regexp.MustCompile(buf.String())
-}
-
-var keywordRegex = initKeywordRegex(warnKeywords, errorKeywords)
-
-func reportChecks(data checkData) CheckReport {
-	result := CheckReport{
-		Errors: make([]CheckFlag, 0),
-		Warnings: make([]CheckFlag, 0),
-	}
-
-	for _, entry := range data.StashEntries {
-		if entry.Branch == data.CurrentBranch {
-			result.Warnings = append(
-				result.Warnings,
-				StashEntryFlag{
-					Number: entry.Number,
-					FullLine: entry.RawString,
-				},
-			)
-		}
-	}
-
-	for _, file := range data.Files {
-		for _, line := range file.ChangedLines {
-			if file.Indents.incompatibleWithLine(line.Indents) {
-				result.Errors = append(
-					result.Errors,
-					LineIndentFlag {
-						FileName: file.FileName,
-						LineNumber: line.LineNumber,
-						FileIndents: file.Indents,
-						LineIndents: line.Indents,
-					},
-				)
-			}
-
-			keyword := keywordRegex.FindString(line.Content)
-			keywordFlag := KeywordPresenceFlag{
-				FileName: file.FileName,
-				LineNumber: line.LineNumber,
-				Keyword: keyword,
-				LineContent: line.Content,
-			}
-			if _, ok := errorKeywords[keyword]; ok {
-				result.Errors = append(result.Errors, keywordFlag)
-			}
-			if _, ok := warnKeywords[keyword]; ok {
-				result.Warnings = append(result.Warnings, keywordFlag)
-			}
-		}
-	}
-
-	return result
-}
-
-// Remove git diff marker, any leading whitespace after that marker, and any trailing whitespace.
-// Additionally, if the trimmed result is more than 80 characters, chop it down to 80
+// Remove any leading and trailing whitespace. Additionally, if the trimmed result is more than 80
+// characters, chop it down to 80
 func trimReportedLine(line string) string {
-	lineRunes := []rune(line)
-	lineRunes = lineRunes[1:]
-	trimmedLine := []rune(strings.TrimSpace(string(lineRunes)))
+	trimmedLine := []rune(strings.TrimSpace(line))
 
 	var finalLine string
 	if len(trimmedLine) > 80 {
@@ -438,3 +479,19 @@ func trimReportedLine(line string) string {
 
 	return finalLine
 }
+
+// The byte offset into a line of a 1-based column (counted in characters, not bytes).
+func byteOffsetOf(line string, column uint) int {
+	if column <= 1 { return 0 }
+	runeCount := uint(1)
+	for offset := range line {
+		if runeCount == column { return offset }
+		runeCount++
+	}
+	return len(line)
+}
+
+// The 1-based column (counted in characters, not bytes) of a byte offset into a line.
+func columnOf(line string, byteOffset int) uint {
+	return uint(utf8.RuneCountInString(line[:byteOffset])) + 1
+}
@@ -1,12 +1,21 @@
 package checking
 
 import (
+	"bytes"
+	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/lorentzforces/check-changes/internal/config"
+	"github.com/lorentzforces/check-changes/internal/git"
+	"github.com/lorentzforces/check-changes/internal/git/gittest"
 	"github.com/lorentzforces/check-changes/internal/platform"
 	"github.com/stretchr/testify/assert"
 )
@@ -62,6 +71,7 @@ func TestParseStashEntriesWithErrors(t *testing.T) {
 		"an absolutely garbage stash entry",
 		"stash@{-999}: On test: a negative number in the stash number",
 		"stash@{nope}: On test: a non-number in the stash number",
+		"stash@{99999999999999999999}: On test: a number too large for the stash number",
 	}
 
 	for _, rawEntry := range rawEntries {
@@ -72,11 +82,11 @@ func TestParseStashEntriesWithErrors(t *testing.T) {
 					"Offending entry: \"%s\"",
 				rawEntry,
 			)
-		} else if errors.Is(err, stashParseError) {
+		} else if errors.Is(err, ErrStashParse) {
 			t.Logf("Expected error: %s", err.Error())
 		} else {
 			t.Errorf(
-				"Expected an error matching 'stashParseError', but was given an unrelated error: %s",
+				"Expected an error matching 'ErrStashParse', but was given an unrelated error: %s",
 				err.Error(),
 			)
 		}
@@ -118,11 +128,26 @@ func TestAccreteIndentKind(t *testing.T) {
 	}
 }
 
+func TestLineIndentMessage(t *testing.T) {
+	flag := LineIndentFlag{
+		FileName: "main.go",
+		LineNumber: 4,
+		FileIndents: IndentTab,
+		LineIndents: IndentSpace,
+	}
+	assert.Equal(
+		t,
+		"line has indentation (IndentSpace) inconsistent with the rest of the file (IndentTab)",
+		flag.Message(),
+	)
+}
+
 //go:embed pawtucket-test.diff
 var pawtucketTest string
 
 func TestParseDiffLinesAlwaysSetsUnknownIndents(t *testing.T) {
-	diffFiles := parseDiffLines(platform.SplitLines(pawtucketTest))
+	diffFiles, err := parseDiffLines(platform.SplitLines(pawtucketTest))
+	assert.NoError(t, err)
 	assert.Len(t, diffFiles, 1)
 	if t.Failed() { t.FailNow() }
 
@@ -135,7 +160,8 @@ func TestParseDiffLinesAlwaysSetsUnknownIndents(t *testing.T) {
 }
 
 func TestParseDiffLines(t *testing.T) {
-	diffFiles := parseDiffLines(platform.SplitLines(pawtucketTest))
+	diffFiles, err := parseDiffLines(platform.SplitLines(pawtucketTest))
+	assert.NoError(t, err)
 	assert.Len(t, diffFiles, 1)
 	if t.Failed() { t.FailNow() }
 
@@ -161,6 +187,442 @@ func TestParseDiffLines(t *testing.T) {
 	assert.Equal(t, IndentUnknown, thirdChangeLine.Indents)
 }
 
+//go:embed renames-test.diff
+var renamesTest string
+
+func TestParseDiffLinesPaths(t *testing.T) {
+	diffFiles, err := parseDiffLines(platform.SplitLines(renamesTest))
+	assert.NoError(t, err)
+	assert.Len(t, diffFiles, 5)
+
+	filesByName := make(map[string]diffFile, len(diffFiles))
+	for _, file := range diffFiles {
+		filesByName[file.FileName] = file
+	}
+
+	type expectedFile struct {
+		oldName string
+		change ChangeType
+		addedLines int
+	}
+	expected := map[string]expectedFile{
+		"copied.txt": {oldName: "source.txt", change: ChangeCopied, addedLines: 1},
+		"naïve.txt": {oldName: "naïve.txt", change: ChangeModified, addedLines: 1},
+		"new-name.txt": {oldName: "old-name.txt", change: ChangeRenamed, addedLines: 1},
+		"with space.txt": {oldName: "with space.txt", change: ChangeModified, addedLines: 1},
+		"moved to here.txt": {oldName: "moved file.txt", change: ChangeRenamed, addedLines: 0},
+	}
+	for name, expectedFile := range expected {
+		file, present := filesByName[name]
+		if !assert.True(t, present, "expected file \"%s\" to be parsed", name) { continue }
+		assert.Equal(t, expectedFile.oldName, file.OldFileName, name)
+		assert.Equal(t, expectedFile.change, file.Change, name)
+		assert.Len(t, file.ChangedLines, expectedFile.addedLines, name)
+	}
+
+	assert.Equal(t, uint(7), filesByName["new-name.txt"].ChangedLines[0].LineNumber)
+	assert.Equal(t, "seven", filesByName["new-name.txt"].ChangedLines[0].Content)
+}
+
+//go:embed status-test.diff
+var statusTest string
+
+func TestParseDiffLinesStatus(t *testing.T) {
+	diffFiles, err := parseDiffLines(platform.SplitLines(statusTest))
+	assert.NoError(t, err)
+	filesByName := make(map[string]diffFile, len(diffFiles))
+	for _, file := range diffFiles {
+		filesByName[file.FileName] = file
+	}
+	assert.Len(t, filesByName, 6)
+
+	added := filesByName["added.txt"]
+	assert.Equal(t, ChangeAdded, added.Change)
+	assert.Equal(t, "100644", added.NewMode)
+	assert.Len(t, added.ChangedLines, 2)
+
+	deleted := filesByName["deleted.txt"]
+	assert.Equal(t, ChangeDeleted, deleted.Change)
+	assert.Len(t, deleted.ChangedLines, 0)
+	assert.Len(t, deleted.RemovedLines(), 2)
+
+	binary := filesByName["image.bin"]
+	assert.True(t, binary.Binary)
+	assert.Equal(t, ChangeModified, binary.Change)
+	assert.Len(t, binary.Hunks, 0)
+
+	script := filesByName["script.sh"]
+	assert.True(t, script.ModeChanged())
+	assert.Equal(t, "100644", script.OldMode)
+	assert.Equal(t, "100755", script.NewMode)
+	assert.False(t, filesByName["long.txt"].ModeChanged())
+}
+
+func TestParseDiffLinesHunks(t *testing.T) {
+	diffFiles, err := parseDiffLines(platform.SplitLines(statusTest))
+	assert.NoError(t, err)
+	var long diffFile
+	for _, file := range diffFiles {
+		if file.FileName == "long.txt" { long = file }
+	}
+	assert.Len(t, long.Hunks, 3)
+	if t.Failed() { t.FailNow() }
+
+	middle := long.Hunks[1]
+	assert.Equal(t, uint(12), middle.OldStart)
+	assert.Equal(t, uint(7), middle.OldCount)
+	assert.Equal(t, uint(12), middle.NewStart)
+	assert.Equal(t, uint(6), middle.NewCount)
+	assert.Equal(t, "line 11", middle.Section)
+
+	removed := long.RemovedLines()
+	assert.Equal(t, []uint{3, 15, 27}, lineNumbersOf(removed))
+	assert.Equal(t, "line 15", removed[1].Content)
+
+	// lines after the removal in the middle hunk are shifted up by one in the new file
+	assert.Equal(t, []uint{3, 26}, lineNumbersOf(long.ChangedLines))
+	last := long.Hunks[2].Lines[len(long.Hunks[2].Lines) - 1]
+	assert.Equal(t, LineContext, last.Kind)
+	assert.Equal(t, uint(30), last.OldLineNumber)
+	assert.Equal(t, uint(29), last.NewLineNumber)
+
+	var tail diffFile
+	for _, file := range diffFiles {
+		if file.FileName == "tail.txt" { tail = file }
+	}
+	assert.Len(t, tail.Hunks, 1)
+	if t.Failed() { t.FailNow() }
+	tailLines := tail.Hunks[0].Lines
+	assert.Len(t, tailLines, 2)
+	assert.True(t, tailLines[0].NoNewlineAtEnd)
+	assert.True(t, tailLines[1].NoNewlineAtEnd)
+	assert.Equal(t, uint(1), tailLines[1].NewLineNumber)
+}
+
+func lineNumbersOf(lines []diffLine) []uint {
+	numbers := make([]uint, len(lines))
+	for i, line := range lines {
+		numbers[i] = line.LineNumber
+	}
+	return numbers
+}
+
+func TestParseDiffLinesKeepsDiffOrder(t *testing.T) {
+	diffFiles, err := parseDiffLines(platform.SplitLines(statusTest))
+	assert.NoError(t, err)
+
+	names := make([]string, len(diffFiles))
+	for i, file := range diffFiles {
+		names[i] = file.FileName
+	}
+	assert.Equal(
+		t,
+		[]string{"added.txt", "deleted.txt", "image.bin", "long.txt", "script.sh", "tail.txt"},
+		names,
+	)
+}
+
+func TestReportSortOrder(t *testing.T) {
+	keywordAt := func(file string, line uint, column uint) Finding {
+		return Finding{
+			Check: "keyword",
+			Flag: KeywordPresenceFlag{FileName: file, LineNumber: line, Column: column, Keyword: "TODO"},
+		}
+	}
+	expected := []Finding{
+		{Check: "stash", Flag: StashEntryFlag{Number: 0}},
+		{Check: "stash", Flag: StashEntryFlag{Number: 1}},
+		keywordAt("a.txt", 2, 1),
+		{Check: "indent", Flag: LineIndentFlag{FileName: "a.txt", LineNumber: 10}},
+		keywordAt("a.txt", 10, 1),
+		keywordAt("a.txt", 10, 7),
+		keywordAt("b/a.txt", 1, 1),
+	}
+
+	report := CheckReport{Findings: slices.Clone(expected)}
+	slices.Reverse(report.Findings)
+	report.sort()
+	assert.Equal(t, expected, report.Findings)
+}
+
+func TestParseHunkHeader(t *testing.T) {
+	type testCase struct {
+		header string
+		expected diffHunk
+	}
+	cases := []testCase{
+		{"@@ -1,6 +1,7 @@", diffHunk{OldStart: 1, OldCount: 6, NewStart: 1, NewCount: 7}},
+		{"@@ -3 +3 @@", diffHunk{OldStart: 3, OldCount: 1, NewStart: 3, NewCount: 1}},
+		{"@@ -0,0 +1 @@", diffHunk{OldStart: 0, OldCount: 0, NewStart: 1, NewCount: 1}},
+		{"@@ -5 +4,0 @@", diffHunk{OldStart: 5, OldCount: 1, NewStart: 4, NewCount: 0}},
+		{
+			"@@ -12,7 +12,6 @@ func main() {",
+			diffHunk{OldStart: 12, OldCount: 7, NewStart: 12, NewCount: 6, Section: "func main() {"},
+		},
+		{
+			"@@@ -1,5 -2 +1,5 @@@ section",
+			diffHunk{
+				OldStart: 1, OldCount: 5,
+				OtherParents: []hunkRange{{Start: 2, Count: 1}},
+				NewStart: 1, NewCount: 5,
+				Section: "section",
+			},
+		},
+	}
+	for _, c := range cases {
+		hunk, err := parseHunkHeader(c.header)
+		assert.NoError(t, err, c.header)
+		c.expected.Lines = make([]hunkLine, 0)
+		assert.Equal(t, c.expected, hunk, c.header)
+	}
+
+	malformed := []string{
+		"@@ -1,6 +1,7",
+		"@@ +1,7 -1,6 @@",
+		"@@ -1,6 @@",
+		"@@@ -1,6 +1,7 @@@",
+		"@@ -a +1 @@",
+		"@@ -1,+1 +1 @@",
+		"@@ -99999999999 +1 @@",
+		"@@",
+	}
+	for _, header := range malformed {
+		_, err := parseHunkHeader(header)
+		assert.Error(t, err, header)
+	}
+}
+
+func TestParseDiffLinesSingleLineHunks(t *testing.T) {
+	rawDiff := `diff --git a/one.txt b/one.txt
+index 587be6b..975fbec 100644
+--- a/one.txt
++++ b/one.txt
+@@ -1 +1 @@
+-x
++y
+@@ -5,0 +6 @@ section
++z
+`
+	diffFiles, err := parseDiffLines(platform.SplitLines(rawDiff))
+	assert.NoError(t, err)
+	assert.Len(t, diffFiles, 1)
+	if t.Failed() { t.FailNow() }
+	assert.Equal(t, []uint{1, 6}, lineNumbersOf(diffFiles[0].ChangedLines))
+}
+
+//go:embed combined-test.diff
+var combinedTest string
+
+func TestParseDiffLinesCombined(t *testing.T) {
+	diffFiles, err := parseDiffLines(platform.SplitLines(combinedTest))
+	assert.NoError(t, err)
+	assert.Len(t, diffFiles, 1)
+	if t.Failed() { t.FailNow() }
+
+	merged := diffFiles[0]
+	assert.Equal(t, "merged.txt", merged.FileName)
+	assert.Len(t, merged.Hunks, 1)
+	if t.Failed() { t.FailNow() }
+	assert.Equal(t, []hunkRange{{Start: 1, Count: 5}}, merged.Hunks[0].OtherParents)
+
+	// lines new relative to either parent count as added
+	assert.Equal(t, []uint{2, 4, 5}, lineNumbersOf(merged.ChangedLines))
+	assert.Equal(t, "five from merge", merged.ChangedLines[2].Content)
+	// only lines removed from the first parent have an old line number
+	assert.Equal(t, []uint{2, 0, 0, 5}, lineNumbersOf(merged.RemovedLines()))
+}
+
+func TestParseDiffLinesErrors(t *testing.T) {
+	header := "diff --git a/x b/x\n--- a/x\n+++ b/x\n"
+	malformed := map[string]struct{ rawDiff string; line int }{
+		"bad content marker": {header + "@@ -1 +1 @@\n?password = \"hunter22\"\n", 5},
+		"too many lines": {header + "@@ -1 +1 @@\n+x\n+password = \"hunter22\"\n", 6},
+		"bad hunk header": {header + "@@ -1 +x @@ password = \"hunter22\"\n+x\n", 4},
+		"bad hunk range": {header + "@@ -1 +hunter22 @@\n+x\n", 4},
+		"no file name": {"diff --git a/x b/y z\n@@ -0,0 +1 @@\n+x\n", 1},
+	}
+	for name, c := range malformed {
+		_, err := parseDiffLines(platform.SplitLines(c.rawDiff))
+		parseErr := &DiffParseError{}
+		if assert.ErrorAs(t, err, &parseErr, name) {
+			assert.Equal(t, c.line, parseErr.Line, name)
+			// errors are shown before secrets are redacted, so they never quote the diff
+			assert.NotContains(t, err.Error(), "hunter22", name)
+		}
+	}
+}
+
+func FuzzParseDiffLines(f *testing.F) {
+	f.Add(pawtucketTest)
+	f.Add(renamesTest)
+	f.Add(statusTest)
+	f.Add(combinedTest)
+	f.Add("diff --git a/x b/x\n@@ -0,0 +1 @@\n+x\n")
+	f.Fuzz(func(t *testing.T, rawDiff string) {
+		// must not panic
+		parseDiffLines(platform.SplitLines(rawDiff))
+		parseDiffLines(strings.Split(rawDiff, "\n"))
+	})
+}
+
+func TestParseGitHeaderPaths(t *testing.T) {
+	oldName, newName, err := parseGitHeaderPaths(`a/with space.txt b/with space.txt`)
+	assert.NoError(t, err)
+	assert.Equal(t, "with space.txt", oldName)
+	assert.Equal(t, "with space.txt", newName)
+
+	oldName, newName, err = parseGitHeaderPaths(`"a/tab\there" b/plain`)
+	assert.NoError(t, err)
+	assert.Equal(t, "tab\there", oldName)
+	assert.Equal(t, "plain", newName)
+
+	oldName, newName, err = parseGitHeaderPaths(`a/plain "b/\"quoted\""`)
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", oldName)
+	assert.Equal(t, `"quoted"`, newName)
+
+	// differing unquoted paths with spaces are ambiguous, and left to the rename header lines
+	_, _, err = parseGitHeaderPaths(`a/moved file.txt b/moved to here.txt`)
+	assert.Error(t, err)
+}
+
+const fakeRepoDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -3,2 +3,4 @@
+ func main() {
++	println("hi")
++    // TODO: more
+ }
+`
+
+const fakeRepoMainGo = `package main
+
+func main() {
+	println("hi")
+    // TODO: more
+}
+`
+
+var fakeDiffArgs = []string{
+	"diff", "--cached", "--no-color", "--no-ext-diff", "--no-textconv", "--no-relative", "-p",
+	"--src-prefix=a/", "--dst-prefix=b/", "HEAD",
+}
+
+func fakeRepo() *gittest.FakeRunner {
+	return gittest.NewFakeRunner().
+		On(gittest.Response{Stdout: "/repo\n"}, "rev-parse", "--show-toplevel").
+		On(gittest.Response{Stdout: "main\n"}, "branch", "--show-current").
+		On(
+			gittest.Response{Stdout: "stash@{0}: WIP on main: 1111111 unfinished\n"},
+			"stash", "list",
+		).
+		On(gittest.Response{Stdout: fakeRepoDiff}, fakeDiffArgs...).
+		On(
+			gittest.CatFileResponse(map[string]string{":main.go": fakeRepoMainGo}),
+			"cat-file", "--batch",
+		).
+		On(
+			gittest.CatFileResponse(map[string]string{":main.go": fakeRepoMainGo}),
+			"cat-file", "--batch-check",
+		).
+		On(
+			gittest.CheckAttrResponse(map[string]map[string]string{}),
+			append([]string{"check-attr", "-z", "--stdin", "--cached"}, gitAttributes...)...,
+		)
+}
+
+func TestCheckChangesWithFakeGit(t *testing.T) {
+	opts := config.Opts{Settings: config.NewSettings(ConfigDefaults())}
+	report, err := CheckChanges(context.Background(), git.NewClient(fakeRepo(), ""), "", &opts)
+	assert.NoError(t, err)
+
+	described := make([]string, len(report.Findings))
+	for i, finding := range report.Findings {
+		location := finding.Flag.Location()
+		described[i] = fmt.Sprintf(
+			"%s %s %s:%d", finding.Severity, finding.Check, location.File, location.Line,
+		)
+	}
+	assert.Equal(
+		t,
+		[]string{
+			"warning stash :0",
+			"error indent main.go:5",
+			"warning keyword main.go:5",
+		},
+		described,
+	)
+	assert.True(t, report.HasErrors())
+}
+
+func TestGatherStateWithFakeGit(t *testing.T) {
+	runner := fakeRepo()
+	data, err := gatherState(context.Background(), git.NewClient(runner, "/somewhere"), "", 0)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "/repo", data.RepoRoot)
+	assert.Equal(t, "main", data.CurrentBranch)
+	assert.Len(t, data.StashEntries, 1)
+	assert.Len(t, data.Files, 1)
+	if t.Failed() { t.FailNow() }
+	assert.Equal(t, IndentTab, data.Files[0].Indents)
+	assert.Equal(t, []uint{4, 5}, lineNumbersOf(data.Files[0].ChangedLines))
+
+	for _, invocation := range runner.Invocations {
+		assert.Equal(t, "/somewhere", invocation.Dir)
+	}
+}
+
+// Never finishes a command until it's canceled.
+type hangingRunner struct{}
+
+func (hangingRunner) Run(invocation git.Invocation) ([]byte, error) {
+	<-invocation.Ctx.Done()
+	return nil, &git.CommandError{Args: invocation.Args, ExitCode: -1, Err: invocation.Ctx.Err()}
+}
+
+func TestCheckChangesTimesOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+
+	opts := config.Opts{Settings: config.NewSettings(ConfigDefaults())}
+	_, err := CheckChanges(ctx, git.NewClient(hangingRunner{}, ""), "", &opts)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "Command \"git rev-parse --show-toplevel\" timed out")
+}
+
+func TestGatherStateErrors(t *testing.T) {
+	notARepo := gittest.NewFakeRunner().On(
+		gittest.Response{
+			Stderr: "fatal: not a git repository (or any of the parent directories): .git",
+			ExitCode: 128,
+		},
+		"rev-parse", "--show-toplevel",
+	)
+	_, err := gatherState(context.Background(), git.NewClient(notARepo, ""), "", 0)
+	assert.ErrorIs(t, err, git.ErrNotARepo)
+
+	badRev := fakeRepo().On(
+		gittest.Response{
+			Stderr: "fatal: ambiguous argument 'HEAD': unknown revision or path not in the working tree.",
+			ExitCode: 128,
+		},
+		fakeDiffArgs...,
+	)
+	_, err = gatherState(context.Background(), git.NewClient(badRev, ""), "", 0)
+	assert.ErrorIs(t, err, git.ErrBadRev)
+
+	malformedDiff := fakeRepo().On(
+		gittest.Response{Stdout: "diff --git a/x b/x\n@@ nonsense @@\n"},
+		fakeDiffArgs...,
+	)
+	_, err = gatherState(context.Background(), git.NewClient(malformedDiff, ""), "", 0)
+	parseErr := &DiffParseError{}
+	assert.ErrorAs(t, err, &parseErr)
+}
+
 func TestPopulateFileInfo(t *testing.T) {
 	spaceFile := strings.NewReader(`file header
     test
@@ -190,6 +652,33 @@ func TestPopulateFileInfo(t *testing.T) {
 	}
 }
 
+func TestPopulateFileInfoLineEndings(t *testing.T) {
+	testCases := []struct {
+		content string
+		addedLines []uint
+		expected LineEnding
+	} {
+		{ "one\ntwo\r\nthree\n", nil, LineEndingLF },
+		{ "one\r\ntwo\r\nthree\n", nil, LineEndingCRLF },
+		{ "one\r\ntwo\n", nil, LineEndingNone },
+		{ "no ending at all", nil, LineEndingNone },
+		{ "", nil, LineEndingNone },
+		// added lines don't get a say, however many there are
+		{ "one\ntwo\r\nthree\r\nfour\r\nfive\n", []uint{2, 3, 4}, LineEndingLF },
+		{ "one\ntwo\r\nthree\r\nfour\r\nfive", []uint{2, 3, 4, 5}, LineEndingLF },
+		// unless they're all there is
+		{ "one\r\ntwo\r\nthree\n", []uint{1, 2, 3}, LineEndingCRLF },
+	}
+	for _, testCase := range testCases {
+		diffFile := &diffFile{}
+		for _, lineNumber := range testCase.addedLines {
+			diffFile.ChangedLines = append(diffFile.ChangedLines, diffLine{LineNumber: lineNumber})
+		}
+		populateFileInfo(diffFile, strings.NewReader(testCase.content))
+		assert.Equal(t, testCase.expected, diffFile.LineEnding, "%q", testCase.content)
+	}
+}
+
 func TestKeywordDetection(t *testing.T) {
 	testData := checkData{
 		Files: []diffFile{
@@ -223,23 +712,973 @@ func TestKeywordDetection(t *testing.T) {
 		},
 	}
 
-	result := reportChecks(testData)
+	result := runChecks(testData, defaultChecks())
+	warnings := result.WithSeverity(SeverityWarning)
+	errs := result.WithSeverity(SeverityError)
 
-	assert.Len(t, result.Warnings, 1, "expected exactly one warning-level flag")
-	assert.Len(t, result.Errors, 1, "expected exactly one error-level flag")
+	assert.Len(t, warnings, 1, "expected exactly one warning-level flag")
+	assert.Len(t, errs, 1, "expected exactly one error-level flag")
 	if t.Failed() { t.FailNow() }
 
-	assert.IsType(t, KeywordPresenceFlag{}, result.Warnings[0])
-	assert.IsType(t, KeywordPresenceFlag{}, result.Errors[0])
+	assert.IsType(t, KeywordPresenceFlag{}, warnings[0].Flag)
+	assert.IsType(t, KeywordPresenceFlag{}, errs[0].Flag)
 	if t.Failed() { t.FailNow() }
-	warnFlag := result.Warnings[0].(KeywordPresenceFlag)
-	errFlag := result.Errors[0].(KeywordPresenceFlag)
+	warnFlag := warnings[0].Flag.(KeywordPresenceFlag)
+	errFlag := errs[0].Flag.(KeywordPresenceFlag)
 
 	assert.Equal(t, "test-warn.txt", warnFlag.FileName)
 	assert.Equal(t, "TODO", warnFlag.Keyword)
 	assert.Equal(t, uint(4), warnFlag.LineNumber)
+	assert.Equal(t, uint(4), warnFlag.Column)
+	assert.Equal(t, "keyword", warnings[0].Check)
 
 	assert.Equal(t, "test-error.txt", errFlag.FileName)
 	assert.Equal(t, "NOCHECKIN", errFlag.Keyword)
 	assert.Equal(t, uint(6), errFlag.LineNumber)
 }
+
+// Every registered check with its default configuration.
+func defaultChecks() []configuredCheck {
+	checks, err := configureChecks(config.NewSettings(ConfigDefaults()))
+	platform.AssertNoErr(err)
+	return checks
+}
+
+func TestRegisteredCheckNamesAreUnique(t *testing.T) {
+	seen := make(map[string]struct{}, len(registeredChecks))
+	for _, check := range RegisteredChecks() {
+		_, isDuplicate := seen[check.Name()]
+		assert.False(t, isDuplicate, "check name \"%s\" is registered more than once", check.Name())
+		seen[check.Name()] = struct{}{}
+	}
+}
+
+func TestEveryKeywordOnALineIsFlagged(t *testing.T) {
+	settings := config.NewSettings(append(
+		ConfigDefaults(),
+		config.Entry{ Key: "keyword.FIXME.severity", Value: "error" },
+		config.Entry{ Key: "keyword.FIXME.ignoreCase", Value: "true" },
+		config.Entry{ Key: "keyword.ticket.pattern", Value: `ABC-\d+` },
+		config.Entry{ Key: "keyword.ticket.regex", Value: "true" },
+		config.Entry{ Key: "keyword.ticket.message", Value: "references a ticket" },
+	))
+	checks, err := configureChecks(settings)
+	assert.Nil(t, err)
+	if t.Failed() { t.FailNow() }
+
+	testData := checkData{
+		Files: []diffFile{
+			diffFile{
+				FileName: "test.txt",
+				ChangedLines: []diffLine{
+					diffLine{
+						LineNumber: 1,
+						Content: "// TODO fixme: see ABC-123 (NOCHECKIN)",
+					},
+					diffLine{
+						LineNumber: 2,
+						Content: "// TODOS and ABC-xyz are not keywords",
+					},
+				},
+			},
+		},
+	}
+
+	result := runChecks(testData, checks)
+
+	assert.Len(t, result.WithSeverity(SeverityError), 2, "expected NOCHECKIN and FIXME as errors")
+	assert.Len(t, result.WithSeverity(SeverityWarning), 2, "expected TODO and ticket as warnings")
+	if t.Failed() { t.FailNow() }
+
+	flaggedKeywords := make([]string, 0)
+	for _, finding := range result.Findings {
+		keywordFlag := finding.Flag.(KeywordPresenceFlag)
+		assert.Equal(t, uint(1), keywordFlag.LineNumber)
+		flaggedKeywords = append(flaggedKeywords, keywordFlag.Keyword)
+	}
+	assert.ElementsMatch(t, []string{"NOCHECKIN", "FIXME", "TODO", "ticket"}, flaggedKeywords)
+
+	ticketFlag := result.WithSeverity(SeverityWarning)[1].Flag.(KeywordPresenceFlag)
+	assert.Equal(t, "references a ticket", ticketFlag.Message())
+	assert.Equal(t, "ABC-123", ticketFlag.MatchedText)
+	assert.Equal(t, uint(20), ticketFlag.Column)
+
+	repeated := checkData{
+		Files: []diffFile{
+			diffFile{
+				FileName: "test.txt",
+				ChangedLines: []diffLine{
+					diffLine{ LineNumber: 1, Content: "TODO: one thing, TODO: another" },
+				},
+			},
+		},
+	}
+	columns := make([]uint, 0)
+	for _, finding := range runChecks(repeated, checks).Findings {
+		columns = append(columns, finding.Flag.Location().Column)
+	}
+	assert.Equal(t, []uint{1, 18}, columns)
+}
+
+func TestInvalidKeywordRegexIsAnError(t *testing.T) {
+	settings := config.NewSettings(append(
+		ConfigDefaults(),
+		config.Entry{ Key: "keyword.broken.pattern", Value: `(unclosed` },
+		config.Entry{ Key: "keyword.broken.regex", Value: "true" },
+	))
+	_, err := configureChecks(settings)
+	assert.NotNil(t, err)
+}
+
+func TestParseSuppressions(t *testing.T) {
+	suppressions := parseSuppressions(
+		"x := 1 // check-changes:ignore[keyword, indent] check-changes:ignore-file[indent]",
+		7,
+	)
+	assert.Equal(
+		t,
+		[]suppression{
+			{ LineNumber: 7, FileWide: false, Checks: []string{"keyword", "indent"} },
+			{ LineNumber: 7, FileWide: true, Checks: []string{"indent"} },
+		},
+		suppressions,
+	)
+
+	suppressions = parseSuppressions("// check-changes:ignore", 1)
+	assert.Len(t, suppressions, 1)
+	assert.Empty(t, suppressions[0].Checks)
+
+	assert.Empty(t, parseSuppressions("// check-changes: nothing to see here", 1))
+}
+
+func TestApplySuppressions(t *testing.T) {
+	file := diffFile{
+		FileName: "test.txt",
+		Indents: IndentTab,
+		ChangedLines: []diffLine{
+			diffLine{ LineNumber: 2, Indents: IndentSpace, Content: "  // TODO: suppressed" },
+			diffLine{ LineNumber: 3, Indents: IndentTab, Content: "\t// TODO: not suppressed" },
+			diffLine{ LineNumber: 5, Content: "// TODO check-changes:ignore[keyword]" },
+			diffLine{ LineNumber: 6, Content: "// check-changes:ignore[keyword]" },
+		},
+	}
+	populateFileInfo(&file, strings.NewReader(`	tab indents
+  // TODO: suppressed
+	// TODO: not suppressed
+// check-changes:ignore-file[indent] check-changes:ignore[keyword]
+// TODO check-changes:ignore[keyword]
+// check-changes:ignore[keyword]
+`))
+	data := checkData{Files: []diffFile{file}}
+
+	report := runChecks(data, defaultChecks())
+	applySuppressions(&report, data.Files, true)
+
+	suppressedLines := make([]uint, 0)
+	for _, finding := range report.Suppressed {
+		suppressedLines = append(suppressedLines, finding.Flag.Location().Line)
+	}
+	// the indent flag on line 2 is suppressed for the whole file, and line 5 suppresses itself
+	assert.ElementsMatch(t, []uint{2, 5}, suppressedLines)
+
+	assert.Len(t, report.Findings, 3)
+	if t.Failed() { t.FailNow() }
+	assert.Equal(t, uint(2), report.Findings[0].Flag.Location().Line)
+	assert.Equal(t, uint(3), report.Findings[1].Flag.Location().Line)
+
+	// only unused suppressions on added lines are reported
+	unused := report.Findings[2]
+	assert.Equal(t, unusedSuppressionCheck, unused.Check)
+	assert.Equal(t, uint(6), unused.Flag.Location().Line)
+}
+
+func TestBareSuppressionsLeaveBlockingChecksAlone(t *testing.T) {
+	awsKey := "AKIA" + "IOSFODNN7EXAMPLE"
+	content := "// check-changes:ignore-file\n" +
+		"key := \"" + awsKey + "\" // TODO\n" +
+		"<<<<<<< HEAD\n" +
+		"key := \"" + awsKey + "\" // check-changes:ignore[secret]\n"
+	file := diffFile{
+		FileName: "test.go",
+		ChangedLines: numberedLines(strings.Split(strings.TrimSuffix(content, "\n"), "\n")...),
+	}
+	populateFileInfo(&file, strings.NewReader(content))
+	data := checkData{Files: []diffFile{file}}
+
+	report := runChecks(data, defaultChecks())
+	applySuppressions(&report, data.Files, false)
+
+	secretLine := func(flag SecretFlag) string { return fmt.Sprint(flag.LineNumber) }
+	assert.Equal(
+		t,
+		[]string{"2"},
+		describeFindings(t, report.Findings, "secret", SeverityError, secretLine),
+	)
+	assert.Equal(
+		t,
+		[]string{"<<<<<<<"},
+		describeFindings(
+			t, report.Findings, "conflict-marker", SeverityError,
+			func(flag ConflictMarkerFlag) string { return flag.Marker },
+		),
+	)
+
+	// a directive which names the check still suppresses it, and other checks are suppressed
+	assert.Equal(
+		t,
+		[]string{"4"},
+		describeFindings(t, report.Suppressed, "secret", SeverityError, secretLine),
+	)
+	assert.Equal(
+		t,
+		[]string{"test.go:2 TODO"},
+		keywordsOf(slices.DeleteFunc(
+			slices.Clone(report.Suppressed),
+			func(finding Finding) bool { return finding.Check != "keyword" },
+		)),
+	)
+}
+
+func TestBaselineSurvivesMovedLines(t *testing.T) {
+	findingAt := func(lineNumber uint, content string) Finding {
+		return Finding{
+			Check: "keyword",
+			Severity: SeverityWarning,
+			Flag: KeywordPresenceFlag{
+				FileName: "test.txt",
+				LineNumber: lineNumber,
+				Keyword: "TODO",
+				LineContent: content,
+			},
+		}
+	}
+
+	var buf bytes.Buffer
+	err := NewBaseline([]Finding{
+		findingAt(3, "// TODO: one"),
+		findingAt(9, "// TODO: two"),
+		findingAt(12, "// TODO: two"),
+	}).Write(&buf)
+	assert.Nil(t, err)
+	baseline, err := ReadBaseline(&buf)
+	assert.Nil(t, err)
+	if t.Failed() { t.FailNow() }
+	assert.Len(t, baseline.Findings, 2)
+
+	report := CheckReport{
+		Findings: []Finding{
+			// moved, and re-indented
+			findingAt(20, "\t// TODO: one"),
+			findingAt(30, "// TODO: two"),
+			findingAt(31, "// TODO: two"),
+			// a third copy wasn't in the baseline
+			findingAt(32, "// TODO: two"),
+			findingAt(33, "// TODO: three"),
+		},
+	}
+	applyBaseline(&report, baseline)
+
+	assert.Len(t, report.Baselined, 3)
+	assert.Len(t, report.Findings, 2)
+	if t.Failed() { t.FailNow() }
+	assert.Equal(t, uint(32), report.Findings[0].Flag.Location().Line)
+	assert.Equal(t, uint(33), report.Findings[1].Flag.Location().Line)
+}
+
+func keywordsOf(findings []Finding) []string {
+	described := make([]string, len(findings))
+	for i, finding := range findings {
+		flag := finding.Flag.(KeywordPresenceFlag)
+		described[i] = fmt.Sprintf("%s:%d %s", flag.FileName, flag.LineNumber, flag.Keyword)
+	}
+	return described
+}
+
+// Added lines with the given contents, numbered from 1.
+func numberedLines(contents ...string) []diffLine {
+	lines := make([]diffLine, len(contents))
+	for i, content := range contents {
+		lines[i] = diffLine{LineNumber: uint(i + 1), Content: content}
+	}
+	return lines
+}
+
+// Describes each of the findings from one check with flags of type F, which should all have the
+// given severity. Checks which raise more than one type of flag are described one type at a time.
+func describeFindings[F CheckFlag](
+	t *testing.T,
+	findings []Finding,
+	check string,
+	severity Severity,
+	describe func(flag F) string,
+) []string {
+	t.Helper()
+	described := make([]string, 0)
+	for _, finding := range findings {
+		if finding.Check != check { continue }
+		flag, ok := finding.Flag.(F)
+		if !ok { continue }
+		assert.Equal(t, severity, finding.Severity)
+		described = append(described, describe(flag))
+	}
+	return described
+}
+
+func TestCheckCommits(t *testing.T) {
+	repo := gittest.NewRepo(t).
+		StageFile("a.go", "package a\n").
+		Commit("initial commit").
+		Push().
+		StageFile("a.go", "package a\n\n// NOCHECKIN\n").
+		StageFile("b.go", "package b\n\n// TODO: later\n").
+		Commit("add a and b").
+		StageFile("a.go", "package a\n").
+		Commit("clean up a").
+		StageFile("c.go", "package c\n\n// TODO: later\n").
+		Commit("add c")
+
+	opts := config.Opts{Settings: config.NewSettings(ConfigDefaults())}
+	rangeReport, err := CheckCommits(context.Background(), repo.Client(), "origin/main", &opts)
+	assert.NoError(t, err)
+	reports := rangeReport.Commits
+
+	subjects := make([]string, len(reports))
+	for i, report := range reports {
+		subjects[i] = report.Commit.Subject
+	}
+	assert.Equal(t, []string{"add a and b", "clean up a", "add c"}, subjects)
+	assert.Equal(t, repo.RevParse("HEAD"), reports[2].Commit.ID)
+
+	// the NOCHECKIN was removed again by the next commit
+	assert.Equal(t, []string{"b.go:3 TODO"}, keywordsOf(reports[0].Findings))
+	assert.Equal(t, []string{"a.go:3 NOCHECKIN"}, keywordsOf(reports[0].Fixed))
+	assert.False(t, reports[0].HasErrors())
+
+	assert.Empty(t, reports[1].Findings)
+	assert.Empty(t, reports[1].Fixed)
+
+	assert.Equal(t, []string{"c.go:3 TODO"}, keywordsOf(reports[2].Findings))
+	assert.Empty(t, reports[2].Fixed)
+
+	assert.Empty(t, rangeReport.Unattributed.Findings)
+
+	// nothing after the base, nothing to check
+	rangeReport, err = CheckCommits(context.Background(), repo.Client(), "HEAD", &opts)
+	assert.NoError(t, err)
+	assert.Empty(t, rangeReport.Commits)
+	assert.Empty(t, rangeReport.Unattributed.Findings)
+}
+
+func TestCheckCommitsWithAMerge(t *testing.T) {
+	repo := gittest.NewRepo(t).
+		StageFile("a.go", "package a\n\nconst x = 0\n").
+		Commit("initial commit").
+		Push().
+		Branch("other").
+		StageFile("a.go", "package a\n\nconst x = 1\n").
+		Commit("set x to 1").
+		Checkout("main").
+		StageFile("a.go", "package a\n\nconst x = 2\n").
+		Commit("set x to 2")
+	// the conflict is resolved with a line which neither side had
+	repo.Git("merge", "--quiet", "--no-ff", "--strategy-option=ours", "--no-commit", "other")
+	repo.StageFile("a.go", "package a\n\nconst x = 3 // NOCHECKIN\n").Commit("merge other")
+
+	opts := config.Opts{Settings: config.NewSettings(ConfigDefaults())}
+	rangeReport, err := CheckCommits(context.Background(), repo.Client(), "origin/main", &opts)
+	assert.NoError(t, err)
+
+	assert.Len(t, rangeReport.Commits, 2, "the merge commit itself isn't checked")
+	for _, report := range rangeReport.Commits {
+		assert.Empty(t, report.Findings)
+	}
+	assert.Equal(t, []string{"a.go:3 NOCHECKIN"}, keywordsOf(rangeReport.Unattributed.Findings))
+	assert.True(t, rangeReport.HasErrors())
+}
+
+func TestCheckCommitsFollowsRenames(t *testing.T) {
+	content := "package a\n\nfunc A() {\n\t// NOCHECKIN\n\treturn\n}\n"
+	repo := gittest.NewRepo(t).
+		StageFile("a.go", "package a\n").
+		Commit("initial commit").
+		Push().
+		StageFile("a.go", content).
+		Commit("add A")
+	repo.Git("mv", "a.go", "b.go")
+	repo.Commit("rename a to b")
+	repo.Git("mv", "b.go", "c.go")
+	repo.StageFile("c.go", content + "\nfunc C() {}\n").Commit("rename b to c, and add C")
+
+	opts := config.Opts{Settings: config.NewSettings(ConfigDefaults())}
+	rangeReport, err := CheckCommits(context.Background(), repo.Client(), "origin/main", &opts)
+	assert.NoError(t, err)
+
+	// the NOCHECKIN is still there, just in a file with another name
+	assert.Len(t, rangeReport.Commits, 3)
+	if t.Failed() { t.FailNow() }
+	assert.Equal(t, []string{"a.go:4 NOCHECKIN"}, keywordsOf(rangeReport.Commits[0].Findings))
+	for _, report := range rangeReport.Commits {
+		assert.Empty(t, report.Fixed, report.Commit.Subject)
+	}
+	assert.Empty(t, rangeReport.Unattributed.Findings)
+	assert.True(t, rangeReport.HasErrors())
+}
+
+func TestConflictMarkers(t *testing.T) {
+	testData := checkData{
+		Files: []diffFile{
+			diffFile{
+				FileName: "main.go",
+				ChangedLines: numberedLines(
+					"<<<<<<< HEAD",
+					"x := 1",
+					"||||||| merged common ancestors",
+					"x := 0",
+					"=======",
+					"x := 2",
+					">>>>>>> feature\r",
+					"<<<<<<<< not a marker",
+					"\t=======",
+					"======= not a marker either",
+				),
+			},
+			diffFile{
+				FileName: "README.md",
+				ChangedLines: numberedLines("Heading", "======="),
+			},
+			diffFile{
+				FileName: "docs/conflicted.rst",
+				ChangedLines: numberedLines("Heading", "=======", ">>>>>>>"),
+			},
+		},
+	}
+
+	result := runChecks(testData, defaultChecks())
+	described := describeFindings(
+		t, result.Findings, "conflict-marker", SeverityError,
+		func(flag ConflictMarkerFlag) string {
+			return fmt.Sprintf("%s:%d %s", flag.FileName, flag.LineNumber, flag.Marker)
+		},
+	)
+	assert.Equal(
+		t,
+		[]string{
+			"main.go:1 <<<<<<<",
+			"main.go:3 |||||||",
+			"main.go:5 =======",
+			"main.go:7 >>>>>>>",
+			// a lone separator is a heading underline, unless the file has other markers
+			"docs/conflicted.rst:2 =======",
+			"docs/conflicted.rst:3 >>>>>>>",
+		},
+		described,
+	)
+}
+
+func TestMatchesGlob(t *testing.T) {
+	testCases := []struct{
+		pattern string
+		path string
+		expected bool
+	} {
+		{ "*.md", "README.md", true },
+		{ "*.md", "docs/guide.md", true },
+		{ "*.md", "docs/guide.mdx", false },
+		{ "docs/*.md", "docs/guide.md", true },
+		{ "docs/*.md", "docs/deep/guide.md", false },
+		{ "/docs/*.md", "docs/guide.md", true },
+		{ "testdata/", "testdata/keys/id_rsa", true },
+		{ "**/testdata/**", "internal/checking/testdata/fixture.json", true },
+		{ "**/testdata/**", "internal/testdata.go", false },
+		{ "internal/**/*_test.go", "internal/git/git_test.go", true },
+		{ "internal/**/*_test.go", "internal/git_test.go", true },
+		{ "[", "[", false },
+	}
+	for _, testCase := range testCases {
+		assert.Equal(
+			t,
+			testCase.expected,
+			matchesGlob(testCase.pattern, testCase.path),
+			"%s against %s", testCase.pattern, testCase.path,
+		)
+	}
+}
+
+func TestSecretDetection(t *testing.T) {
+	// the secrets are split up so that this file doesn't contain any
+	awsKey := "AKIA" + "IOSFODNN7EXAMPLE"
+	jwt := "eyJ" + "hbGciOiJIUzI1NiJ9.eyJ" + "zdWIiOiIxMjM0NTY3ODkwIn0." +
+		"dozjgNryP4J3jVmNHl0w5N_XgL0n3I9PlFUP0THsR8U"
+	privateKeyHeader := "-----BEGIN RSA " + "PRIVATE KEY-----"
+	keyBody := "MIIBOg" + "IBAAJBAKj34GkxFhD90vcNLYLInFEX6Ppy1tPf9Cnzj4p4WGeKLs1Pt8Qu"
+	testData := checkData{
+		Files: []diffFile{
+			diffFile{
+				FileName: "config.go",
+				ChangedLines: numberedLines(
+					privateKeyHeader,
+					"  " + keyBody + " ",
+					"-----END RSA PRIVATE KEY-----",
+					"key := \"" + awsKey + "\" // and " + jwt,
+					"password: \"hunter22\" // TODO rotate",
+					"password = \"${DB_PASSWORD}\"",
+					"password = readPassword()",
+					"apiKey = \"" + "q8Vz3LmX0pR7tY2wK9sD4fH6\"",
+					"apiKey = \"aaaaaaaaaaaaaaaaaaaaaaaa\"",
+				),
+			},
+			diffFile{
+				FileName: "internal/testdata/fixture.go",
+				ChangedLines: numberedLines("key := \"" + awsKey + "\""),
+			},
+		},
+	}
+
+	settings := config.NewSettings(append(
+		ConfigDefaults(),
+		config.Entry{ Key: "secrets.allow", Value: "testdata/" },
+		config.Entry{ Key: "secrets.allow", Value: "**/testdata/**" },
+	))
+	checks, err := configureChecks(settings)
+	assert.NoError(t, err)
+	result := runChecks(testData, checks)
+
+	// the secret is never printed or serialized, by any check
+	for _, finding := range result.Findings {
+		serialized, err := json.Marshal(finding.Flag)
+		assert.NoError(t, err)
+		secrets := []string{keyBody, awsKey, jwt, "hunter22", "q8Vz3LmX0pR7tY2wK9sD4fH6"}
+		for _, secret := range secrets {
+			assert.NotContains(t, string(serialized), secret, finding.Check)
+			assert.NotContains(t, finding.Flag.Message(), secret, finding.Check)
+			assert.NotContains(t, finding.Flag.ContextMsg(), secret, finding.Check)
+		}
+	}
+
+	mask := func(secret string) string { return strings.Repeat("*", len(secret)) }
+	assert.Equal(
+		t,
+		[]string{
+			"config.go:1:1-32 private-key " + mask(privateKeyHeader),
+			"config.go:4:9-29 aws-access-key key := \"" + mask(awsKey) + "\" // and " + mask(jwt),
+			"config.go:4:38-130 jwt key := \"" + mask(awsKey) + "\" // and " + mask(jwt),
+			"config.go:5:12-20 password-assignment password: \"********\" // TODO rotate",
+			"config.go:8:11-35 high-entropy-assignment apiKey = \"" + mask("q8Vz3LmX0pR7tY2wK9sD4fH6") +
+				"\"",
+		},
+		describeFindings(
+			t, result.Findings, "secret", SeverityError,
+			func(flag SecretFlag) string {
+				return fmt.Sprintf(
+					"%s:%d:%d-%d %s %s",
+					flag.FileName, flag.LineNumber, flag.Column, flag.EndColumn, flag.Rule,
+					flag.RedactedLine,
+				)
+			},
+		),
+	)
+
+	// what other checks see of the line is redacted, and its columns are still those of the file
+	todo := describeFindings(
+		t, result.Findings, "keyword", SeverityWarning,
+		func(flag KeywordPresenceFlag) string {
+			return fmt.Sprintf("%d:%d %s", flag.LineNumber, flag.Column, flag.LineContent)
+		},
+	)
+	assert.Equal(t, []string{"5:25 password: \"********\" // TODO rotate"}, todo)
+
+	// the lines of a private key are masked up to the line which ends it
+	changedLines := testData.Files[0].ChangedLines
+	assert.Equal(t, "  " + mask(keyBody) + " ", changedLines[1].Content)
+	assert.Equal(t, "-----END RSA PRIVATE KEY-----", changedLines[2].Content)
+}
+
+func TestConfiguredSecretRules(t *testing.T) {
+	settings := config.NewSettings(append(
+		ConfigDefaults(),
+		config.Entry{ Key: "secret.internal-token.pattern", Value: `itk_(?P<secret>[0-9a-f]{8})` },
+		config.Entry{ Key: "secret.internal-token.description", Value: "internal token" },
+		config.Entry{ Key: "secret.password-assignment.enabled", Value: "false" },
+	))
+	checks, err := configureChecks(settings)
+	assert.NoError(t, err)
+
+	testData := checkData{
+		Files: []diffFile{
+			diffFile{
+				FileName: "main.go",
+				ChangedLines: []diffLine{
+					diffLine{ LineNumber: 1, Content: "token := \"itk_0123abcd\"" },
+					diffLine{ LineNumber: 2, Content: "password := \"hunter22\"" },
+				},
+			},
+		},
+	}
+	result := runChecks(testData, checks)
+	assert.Len(t, result.Findings, 1)
+	if t.Failed() { t.FailNow() }
+	flag := result.Findings[0].Flag.(SecretFlag)
+	assert.Equal(t, "internal-token", flag.Rule)
+	assert.Equal(t, "line may contain a secret (internal token)", flag.Message())
+	assert.Equal(t, "token := \"itk_********\"", flag.RedactedLine)
+
+	for _, entry := range []config.Entry{
+		{ Key: "secret.broken.pattern", Value: `(unclosed` },
+		{ Key: "secret.nothing.description", Value: "no pattern" },
+		{ Key: "secret.jwt.minEntropy", Value: "lots" },
+	} {
+		_, err = configureChecks(config.NewSettings(append(ConfigDefaults(), entry)))
+		assert.Error(t, err, entry.Key)
+	}
+}
+
+func TestTrailingWhitespace(t *testing.T) {
+	testData := checkData{
+		Files: []diffFile{
+			diffFile{
+				FileName: "main.go",
+				ChangedLines: numberedLines(
+					"x := 1 \t",
+					"  \t",
+					"",
+					"x := 2\r",
+					"ünïcode  ",
+				),
+			},
+			diffFile{
+				FileName: "docs/README.md",
+				ChangedLines: numberedLines("hard  ", "tab\t", "one ", "   "),
+			},
+			diffFile{
+				FileName: "testdata/fixture.txt",
+				ChangedLines: numberedLines("anything goes  "),
+			},
+			diffFile{
+				FileName: "notes.txt",
+				ChangedLines: numberedLines("   ", "trailing "),
+			},
+		},
+	}
+
+	settings := config.NewSettings(append(
+		ConfigDefaults(),
+		config.Entry{ Key: "whitespace.testdata/.enabled", Value: "false" },
+		config.Entry{ Key: "whitespace.*.txt.blankLines", Value: "false" },
+	))
+	checks, err := configureChecks(settings)
+	assert.NoError(t, err)
+	result := runChecks(testData, checks)
+
+	assert.Equal(
+		t,
+		[]string{
+			"main.go:1:7-9 false",
+			"main.go:2:1-4 true",
+			// columns are counted in characters
+			"main.go:5:8-10 false",
+			// only two or more spaces make a hard line break
+			"docs/README.md:2:4-5 false",
+			"docs/README.md:3:4-5 false",
+			"docs/README.md:4:1-4 true",
+			"notes.txt:2:9-10 false",
+		},
+		describeFindings(
+			t, result.Findings, "trailing-whitespace", SeverityWarning,
+			func(flag TrailingWhitespaceFlag) string {
+				return fmt.Sprintf(
+					"%s:%d:%d-%d %t",
+					flag.FileName, flag.LineNumber, flag.Column, flag.EndColumn, flag.WhitespaceOnly,
+				)
+			},
+		),
+	)
+
+	flag := result.Findings[0].Flag.(TrailingWhitespaceFlag)
+	assert.Equal(t, "line has trailing whitespace", flag.Message())
+	assert.Equal(t, `" \t" at columns 7-8`, flag.ContextMsg())
+	line, start, end := flag.HighlightedLine()
+	assert.Equal(t, " \t", line[start:end])
+}
+
+func TestParseDiffLinesLineEndings(t *testing.T) {
+	rawLines := []string{
+		"diff --git a/dos.txt b/dos.txt",
+		"--- a/dos.txt",
+		"+++ b/dos.txt",
+		"@@ -1,2 +1,3 @@ section\r",
+		" one\r",
+		"-two\r",
+		"+two\r",
+		"+three",
+		"\\ No newline at end of file",
+	}
+	files, err := parseDiffLines(rawLines)
+	assert.NoError(t, err)
+	if t.Failed() { t.FailNow() }
+
+	hunk := files[0].Hunks[0]
+	assert.Equal(t, "section", hunk.Section)
+	endings := make([]string, len(hunk.Lines))
+	for i, line := range hunk.Lines {
+		endings[i] = fmt.Sprintf("%q %s", line.Content, line.LineEnding)
+	}
+	assert.Equal(
+		t,
+		[]string{`"one" CRLF`, `"two" CRLF`, `"two" CRLF`, `"three" none`},
+		endings,
+	)
+	assert.Equal(t, LineEndingCRLF, files[0].ChangedLines[0].LineEnding)
+	assert.Equal(t, LineEndingNone, files[0].ChangedLines[1].LineEnding)
+	assert.Equal(t, LineEndingCRLF, files[0].RemovedLines()[0].LineEnding)
+}
+
+func TestParseDiffLinesWithSuppressedBlankLines(t *testing.T) {
+	// with diff.suppressBlankEmpty, blank context lines come without their leading space
+	rawLines := []string{
+		"diff --git a/f.txt b/f.txt",
+		"--- a/f.txt",
+		"+++ b/f.txt",
+		"@@ -1,3 +1,4 @@",
+		" one",
+		"",
+		" three",
+		"+NOCHECKIN",
+		"",
+		"diff --git a/g.txt b/g.txt",
+		"--- a/g.txt",
+		"+++ b/g.txt",
+		"@@ -1 +1 @@",
+		"-old",
+		"+new",
+	}
+	files, err := parseDiffLines(rawLines)
+	assert.NoError(t, err)
+	if t.Failed() { t.FailNow() }
+
+	assert.Len(t, files, 2)
+	assert.Len(t, files[0].Hunks[0].Lines, 4)
+	assert.Equal(
+		t,
+		hunkLine{Kind: LineContext, OldLineNumber: 2, NewLineNumber: 2, LineEnding: LineEndingLF},
+		files[0].Hunks[0].Lines[1],
+	)
+	assert.Equal(t, []uint{4}, lineNumbersOf(files[0].ChangedLines))
+	assert.Equal(t, []uint{1}, lineNumbersOf(files[1].ChangedLines))
+}
+
+func TestLineEndings(t *testing.T) {
+	lines := []diffLine{
+		diffLine{ LineNumber: 1, Content: "lf", LineEnding: LineEndingLF },
+		diffLine{ LineNumber: 2, Content: "crlf", LineEnding: LineEndingCRLF },
+		diffLine{ LineNumber: 3, Content: "last", LineEnding: LineEndingNone },
+	}
+	testData := checkData{
+		Files: []diffFile{
+			diffFile{ FileName: "unix.txt", LineEnding: LineEndingLF, ChangedLines: lines },
+			diffFile{ FileName: "dos.txt", LineEnding: LineEndingCRLF, ChangedLines: lines },
+			diffFile{ FileName: "mixed.txt", LineEnding: LineEndingNone, ChangedLines: lines },
+			diffFile{
+				FileName: "binary.dat",
+				LineEnding: LineEndingLF,
+				Attributes: map[string]string{"text": "unset", "eol": "unspecified"},
+				ChangedLines: lines,
+			},
+			diffFile{
+				FileName: "normalized.bat",
+				LineEnding: LineEndingCRLF,
+				Attributes: map[string]string{"text": "unspecified", "eol": "crlf"},
+				ChangedLines: lines,
+			},
+		},
+	}
+
+	lineEnding := func(flag LineEndingFlag) string {
+		return fmt.Sprintf(
+			"%s:%d %s, expected %s (attributes: %t)",
+			flag.FileName, flag.LineNumber, flag.LineEnding, flag.Expected, flag.FromAttributes,
+		)
+	}
+
+	assert.Equal(
+		t,
+		[]string{
+			"unix.txt:2 CRLF, expected LF (attributes: false)",
+			"dos.txt:1 LF, expected CRLF (attributes: false)",
+			// the repository copy of a text file has LF endings, whatever eol says
+			"normalized.bat:2 CRLF, expected LF (attributes: true)",
+		},
+		describeFindings(
+			t, runChecks(testData, defaultChecks()).Findings, "line-ending", SeverityWarning, lineEnding,
+		),
+	)
+
+	settings := config.NewSettings(append(
+		ConfigDefaults(),
+		config.Entry{ Key: "check.line-ending.useAttributes", Value: "false" },
+	))
+	checks, err := configureChecks(settings)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]string{
+			"unix.txt:2 CRLF, expected LF (attributes: false)",
+			"dos.txt:1 LF, expected CRLF (attributes: false)",
+			"binary.dat:2 CRLF, expected LF (attributes: false)",
+			"normalized.bat:1 LF, expected CRLF (attributes: false)",
+		},
+		describeFindings(
+			t, runChecks(testData, checks).Findings, "line-ending", SeverityWarning, lineEnding,
+		),
+	)
+}
+
+func TestFileGuard(t *testing.T) {
+	lfs := map[string]string{"filter": "lfs"}
+	testData := checkData{
+		Files: []diffFile{
+			diffFile{ FileName: "small.txt", Change: ChangeAdded, Size: 100 },
+			diffFile{ FileName: "huge.txt", Change: ChangeAdded, Size: 3 * 1024 * 1024 },
+			diffFile{ FileName: "image.png", Change: ChangeAdded, Binary: true, Size: 2048 },
+			diffFile{ FileName: "assets/logo.png", Change: ChangeAdded, Binary: true, Size: 2048 },
+			diffFile{
+				FileName: "model.bin",
+				Change: ChangeAdded,
+				Binary: true,
+				Attributes: lfs,
+				Size: 2048,
+			},
+			diffFile{
+				FileName: "assets/video.mp4",
+				Change: ChangeAdded,
+				Attributes: lfs,
+				LFSPointer: true,
+				Size: 130,
+			},
+			// a rename with no content changes adds nothing new
+			diffFile{ FileName: "renamed.bin", Change: ChangeRenamed, Size: 5000000 },
+			// and a binary file which was already binary was already flagged
+			diffFile{
+				FileName: "updated.png",
+				Change: ChangeModified,
+				Binary: true,
+				OldBinary: true,
+				Size: 2048,
+			},
+			diffFile{ FileName: "was-text.dat", Change: ChangeModified, Binary: true, Size: 2048 },
+			diffFile{ FileName: "deleted.bin", Change: ChangeDeleted, Binary: true, Size: 5000000 },
+		},
+	}
+
+	settings := config.NewSettings(append(
+		ConfigDefaults(),
+		config.Entry{ Key: "check.file-guard.allowBinary", Value: "assets/" },
+	))
+	checks, err := configureChecks(settings)
+	assert.NoError(t, err)
+
+	findings := runChecks(testData, checks).Findings
+	assert.Equal(
+		t,
+		[]string{"huge.txt: file is 3.0 MiB, over the size limit of 1.0 MiB"},
+		describeFindings(
+			t, findings, "file-guard", SeverityError,
+			func(flag LargeFileFlag) string { return flag.FileName + ": " + flag.Message() },
+		),
+	)
+	assert.Equal(
+		t,
+		[]string{
+			"image.png: binary file is outside the paths allowed to have binary files",
+			"model.bin: binary file is outside the paths allowed to have binary files",
+			"was-text.dat: binary file is outside the paths allowed to have binary files",
+		},
+		describeFindings(
+			t, findings, "file-guard", SeverityWarning,
+			func(flag BinaryFileFlag) string { return flag.FileName + ": " + flag.Message() },
+		),
+	)
+	assert.Equal(
+		t,
+		[]string{
+			"model.bin: file is tracked by Git LFS in .gitattributes, but was staged as a " +
+				"regular file instead of an LFS pointer",
+		},
+		describeFindings(
+			t, findings, "file-guard", SeverityError,
+			func(flag LFSPointerFlag) string { return flag.FileName + ": " + flag.Message() },
+		),
+	)
+}
+
+func TestFileGuardWithGit(t *testing.T) {
+	repo := gittest.NewRepo(t).
+		StageFile("image.bin", "\x00\x01old").
+		StageFile("data.dat", "plain text\n").
+		Commit("initial commit").
+		StageFile("image.bin", "\x00\x01new").
+		StageFile("data.dat", "\x00now binary").
+		StageFile("huge.go", "package main\n\n// NOCHECKIN\n" + strings.Repeat("// filler\n", 10))
+
+	opts := config.Opts{Settings: config.NewSettings(append(
+		ConfigDefaults(),
+		config.Entry{ Key: "check.file-guard.maxSize", Value: "64" },
+	))}
+	// nothing but the file guard's flags should be raised
+	assertFlagged := func(findings []Finding) {
+		t.Helper()
+		assert.Len(t, findings, 2)
+		assert.Equal(
+			t,
+			[]string{"huge.go"},
+			describeFindings(
+				t, findings, "file-guard", SeverityError,
+				func(flag LargeFileFlag) string { return flag.FileName },
+			),
+		)
+		assert.Equal(
+			t,
+			[]string{"data.dat"},
+			describeFindings(
+				t, findings, "file-guard", SeverityWarning,
+				func(flag BinaryFileFlag) string { return flag.FileName },
+			),
+		)
+	}
+
+	// the existing binary file isn't flagged again, and the lines of the large file aren't checked
+	report, err := CheckChanges(context.Background(), repo.Client(), "", &opts)
+	assert.NoError(t, err)
+	assertFlagged(report.Findings)
+
+	data, err := gatherState(context.Background(), repo.Client(), "", 64)
+	assert.NoError(t, err)
+	for _, file := range data.Files {
+		assert.Equal(t, file.FileName == "huge.go", file.TooLarge, file.FileName)
+		assert.Equal(t, file.FileName == "image.bin", file.OldBinary, file.FileName)
+	}
+
+	repo.Commit("change things")
+	rangeReport, err := CheckCommits(context.Background(), repo.Client(), "HEAD~1", &opts)
+	assert.NoError(t, err)
+	if assert.Len(t, rangeReport.Commits, 1) {
+		assertFlagged(rangeReport.Commits[0].Findings)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for raw, expected := range map[string]int64{
+		"0": 0, "512": 512, "500k": 500 * 1024, "2M": 2 * 1024 * 1024, "1g": 1024 * 1024 * 1024,
+	} {
+		size, err := parseByteSize(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, size, raw)
+	}
+	for _, raw := range []string{"", "m", "-1k", "1.5m", "1t"} {
+		_, err := parseByteSize(raw)
+		assert.Error(t, err, raw)
+	}
+
+	assert.Equal(t, "100 bytes", formatByteSize(100))
+	assert.Equal(t, "1.5 KiB", formatByteSize(1536))
+	assert.Equal(t, "2.0 GiB", formatByteSize(2 * 1024 * 1024 * 1024))
+}
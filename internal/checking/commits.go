@@ -0,0 +1,154 @@
+package checking
+
+import (
+	"context"
+	"slices"
+
+	"github.com/lorentzforces/check-changes/internal/config"
+	"github.com/lorentzforces/check-changes/internal/git"
+)
+
+// The findings in a single commit's own changes.
+type CommitReport struct {
+	Commit git.Commit
+	CheckReport
+	// Findings which this commit introduced, but which are no longer present by HEAD.
+	Fixed []Finding
+}
+
+// The findings of each commit in a range, and those which no one commit is responsible for.
+type RangeReport struct {
+	// Oldest commit first.
+	Commits []CommitReport
+	// Findings present by HEAD which no commit introduced in its own changes. Merge commits
+	// aren't checked on their own, so these are usually from lines written while resolving a
+	// conflict. Only Findings is filled in.
+	Unattributed CheckReport
+}
+
+func (report RangeReport) HasErrors() bool {
+	for _, commit := range report.Commits {
+		if commit.HasErrors() { return true }
+	}
+	return report.Unattributed.HasErrors()
+}
+
+// Check each commit between baseRev and HEAD against its own diff, oldest commit first. Findings
+// which a later commit fixed are moved to the Fixed list of the commit which introduced them.
+// Checks of the repository's current state (such as of stash entries) have nothing to say about
+// past commits, so they are not run.
+func CheckCommits(
+	ctx context.Context,
+	gitClient *git.Client,
+	baseRev string,
+	opts *config.Opts,
+) (RangeReport, error) {
+	checks, err := configureChecks(opts.Settings)
+	if err != nil { return RangeReport{}, err }
+
+	repoRoot, err := gitClient.RepoRoot(ctx)
+	if err != nil { return RangeReport{}, err }
+
+	baseline, err := readBaselineFile(baselinePath(repoRoot, opts))
+	if err != nil { return RangeReport{}, err }
+
+	commits, err := gitClient.RevList(ctx, baseRev)
+	if err != nil { return RangeReport{}, err }
+
+	reports := make([]CommitReport, 0, len(commits))
+	renames := make([]map[string]string, 0, len(commits))
+	for _, commit := range commits {
+		parent := ""
+		if len(commit.Parents) > 0 { parent = commit.Parents[0] }
+		report, commitRenames, err := checkTreeDiff(
+			ctx, gitClient, repoRoot, parent, commit.ID, checks, opts,
+		)
+		if err != nil { return RangeReport{}, err }
+		applyBaseline(&report, baseline)
+		reports = append(reports, CommitReport{Commit: commit, CheckReport: report})
+		renames = append(renames, commitRenames)
+	}
+
+	// what's still present is whatever the range as a whole introduced
+	mergeBase, err := gitClient.MergeBase(ctx, baseRev, "HEAD")
+	if err != nil { return RangeReport{}, err }
+	tipReport, _, err := checkTreeDiff(ctx, gitClient, repoRoot, mergeBase, "HEAD", checks, opts)
+	if err != nil { return RangeReport{}, err }
+	applyBaseline(&tipReport, baseline)
+	unattributed := separateFixed(reports, renames, tipReport.Findings)
+
+	for i := range reports {
+		reports[i].sort()
+		slices.SortStableFunc(reports[i].Fixed, CompareFindings)
+	}
+	slices.SortStableFunc(unattributed, CompareFindings)
+	return RangeReport{Commits: reports, Unattributed: CheckReport{Findings: unattributed}}, nil
+}
+
+// Also returns the files the diff renamed, from their old paths to their new ones.
+func checkTreeDiff(
+	ctx context.Context,
+	gitClient *git.Client,
+	repoRoot string,
+	from string,
+	to string,
+	checks []configuredCheck,
+	opts *config.Opts,
+) (CheckReport, map[string]string, error) {
+	rawDiffLines, err := gitClient.TreeDiff(ctx, from, to)
+	if err != nil { return CheckReport{}, nil, err }
+	diffFiles, err := gatherFiles(ctx, gitClient, rawDiffLines, from, to, contentSizeLimit(checks))
+	if err != nil { return CheckReport{}, nil, err }
+
+	renames := make(map[string]string)
+	for _, file := range diffFiles {
+		if file.Change == ChangeRenamed { renames[file.OldFileName] = file.FileName }
+	}
+
+	data := checkData{RepoRoot: repoRoot, Files: diffFiles}
+	return findingsFor(data, checks, opts), renames, nil
+}
+
+// Move each commit's findings which aren't among the tip findings into its Fixed list, and return
+// the tip findings which no commit's findings matched. Since line numbers change from commit to
+// commit, findings are matched by fingerprint, as of the path their file has by the tip (following
+// the renames each commit made). Identical findings are counted, and the latest commits are
+// matched first: if a TODO was added, removed, and added again, it's the first one which was fixed.
+func separateFixed(
+	reports []CommitReport,
+	renames []map[string]string,
+	tipFindings []Finding,
+) []Finding {
+	remaining := make(map[string]int, len(tipFindings))
+	for _, finding := range tipFindings {
+		remaining[Fingerprint(finding)]++
+	}
+
+	for i := len(reports) - 1; i >= 0; i-- {
+		report := &reports[i]
+		kept := make([]Finding, 0, len(report.Findings))
+		for _, finding := range report.Findings {
+			tipPath := finding.Flag.Location().File
+			for _, laterRenames := range renames[i + 1:] {
+				if renamed, ok := laterRenames[tipPath]; ok { tipPath = renamed }
+			}
+			fingerprint := fingerprintIn(finding, tipPath)
+			if remaining[fingerprint] > 0 {
+				remaining[fingerprint]--
+				kept = append(kept, finding)
+				continue
+			}
+			report.Fixed = append(report.Fixed, finding)
+		}
+		report.Findings = kept
+	}
+
+	unmatched := make([]Finding, 0)
+	for _, finding := range tipFindings {
+		fingerprint := Fingerprint(finding)
+		if remaining[fingerprint] == 0 { continue }
+		remaining[fingerprint]--
+		unmatched = append(unmatched, finding)
+	}
+	return unmatched
+}
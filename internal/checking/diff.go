@@ -0,0 +1,649 @@
+package checking
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type ChangeType int
+const (
+	ChangeModified ChangeType = iota
+	ChangeAdded
+	ChangeDeleted
+	ChangeRenamed
+	ChangeCopied
+)
+
+func (ct ChangeType) String() string {
+	switch ct {
+		case ChangeModified: return "modified"
+		case ChangeAdded: return "added"
+		case ChangeDeleted: return "deleted"
+		case ChangeRenamed: return "renamed"
+		case ChangeCopied: return "copied"
+	}
+	return fmt.Sprintf("ChangeType(%d)", ct)
+}
+
+type LineEnding int
+const (
+	// No line ending at all (for the last line of a file), or, for a whole file, no clear majority.
+	LineEndingNone LineEnding = iota
+	LineEndingLF
+	LineEndingCRLF
+)
+
+func (le LineEnding) String() string {
+	switch le {
+		case LineEndingNone: return "none"
+		case LineEndingLF: return "LF"
+		case LineEndingCRLF: return "CRLF"
+	}
+	return fmt.Sprintf("LineEnding(%d)", le)
+}
+
+func (le LineEnding) MarshalText() ([]byte, error) {
+	return []byte(le.String()), nil
+}
+
+// One file's worth of a parsed diff. Checks which only care about what was added can use
+// ChangedLines; checks which care about what was removed or moved can walk Hunks.
+type diffFile struct {
+	// The path of the file after the change. For deleted files, this is the path the file had.
+	FileName string
+	// The path of the file before the change, which differs from FileName for renames and copies.
+	OldFileName string
+	Change ChangeType
+	// Binary files have no hunks, since git doesn't show their content.
+	Binary bool
+	// Whether a binary file was binary before the change as well. Only set for binary files which
+	// already existed.
+	OldBinary bool
+	// File modes as git reports them (e.g. "100644"). Empty when the file didn't exist on that side
+	// of the diff, or git didn't say.
+	OldMode string
+	NewMode string
+	// The size in bytes of the file's content after the change.
+	Size int64
+	// Set when the file is over the size limit, in which case its content isn't read and its lines
+	// aren't checked.
+	TooLarge bool
+	// Whether the file's content after the change is a Git LFS pointer, rather than the file itself.
+	LFSPointer bool
+	Indents IndentKind
+	// The line ending most of the file's lines have, not counting the added lines (unless there are
+	// no others).
+	LineEnding LineEnding
+	// Git attributes of the file (see gitAttributes), as reported by "git check-attr".
+	Attributes map[string]string
+	// Added lines only, numbered by their position in the new file.
+	ChangedLines []diffLine
+	Hunks []diffHunk
+	Suppressions []suppression
+}
+
+func (file diffFile) ModeChanged() bool {
+	return len(file.OldMode) > 0 && len(file.NewMode) > 0 && file.OldMode != file.NewMode
+}
+
+// Removed lines only, numbered by their position in the old file.
+func (file diffFile) RemovedLines() []diffLine {
+	removed := make([]diffLine, 0)
+	for _, hunk := range file.Hunks {
+		for _, line := range hunk.Lines {
+			if line.Kind != LineRemoved { continue }
+			removed = append(removed, diffLine{
+				LineNumber: line.OldLineNumber,
+				Indents: whichLineIndents([]rune(line.Content)),
+				Content: line.Content,
+				LineEnding: line.LineEnding,
+			})
+		}
+	}
+	return removed
+}
+
+type diffLine struct {
+	LineNumber uint
+	Indents IndentKind
+	// The line's content, without its line ending.
+	Content string
+	LineEnding LineEnding
+}
+
+// A contiguous section of a diff. Starts and counts are as given in the hunk header; a count of 0
+// means the hunk has no lines on that side, in which case the start is the line before the hunk.
+type diffHunk struct {
+	OldStart uint
+	OldCount uint
+	// For combined diffs of merges, the ranges in each parent after the first.
+	OtherParents []hunkRange
+	NewStart uint
+	NewCount uint
+	// Whatever git put after the range information, usually the enclosing function or section.
+	Section string
+	Lines []hunkLine
+}
+
+type hunkRange struct {
+	Start uint
+	Count uint
+}
+
+type LineKind int
+const (
+	LineContext LineKind = iota
+	LineAdded
+	LineRemoved
+)
+
+func (lk LineKind) String() string {
+	switch lk {
+		case LineContext: return "context"
+		case LineAdded: return "added"
+		case LineRemoved: return "removed"
+	}
+	return fmt.Sprintf("LineKind(%d)", lk)
+}
+
+// A line within a hunk. Line numbers are zero on the side of the diff the line isn't present in.
+// For combined diffs, a line is added if it's new relative to any parent, and the old line number
+// is that of the first parent.
+type hunkLine struct {
+	Kind LineKind
+	OldLineNumber uint
+	NewLineNumber uint
+	// The line's content, without its line ending.
+	Content string
+	LineEnding LineEnding
+	// Set when the line is the last in its file and has no trailing newline.
+	NoNewlineAtEnd bool
+}
+
+// The diff output from git could not be understood. Messages never quote the diff, which may have
+// secrets in it that haven't been redacted yet.
+type DiffParseError struct {
+	// The line of the diff output the problem was found at, starting from 1.
+	Line int
+	Message string
+}
+
+func (err *DiffParseError) Error() string {
+	return fmt.Sprintf("Could not parse diff output at line %d: %s", err.Line, err.Message)
+}
+
+
+// The paths of a single file in a diff, gathered from the various header lines which mention them.
+// Each kind of header line is more authoritative than the last:
+//   - "diff --git a/old b/new" is ambiguous when paths contain spaces
+//   - "--- a/old" and "+++ b/new" are only present when file content changed
+//   - "rename from old", "copy to new", etc. are only present for renames and copies
+type diffPaths struct {
+	fromGitHeader [2]string
+	fromMarkers [2]string
+	fromRenameOrCopy [2]string
+}
+
+func (paths diffPaths) resolve() (string, string) {
+	result := paths.fromGitHeader
+	for _, candidate := range [][2]string{paths.fromMarkers, paths.fromRenameOrCopy} {
+		if len(candidate[0]) > 0 { result[0] = candidate[0] }
+		if len(candidate[1]) > 0 { result[1] = candidate[1] }
+	}
+	return result[0], result[1]
+}
+
+// Files are returned in the order they appear in the diff.
+func parseDiffLines(rawLines []string) ([]diffFile, error) {
+	files := make([]*diffFile, 0)
+	var currentFile *diffFile
+	var paths diffPaths
+	inHeader := false
+	headerLineIndex := 0
+	var currentHunk *diffHunk
+	var hunkState hunkCursor
+
+	// the file name isn't certain until the end of its header, so it's only collected once its
+	// first chunk starts (or the next file starts, for files without any chunks)
+	finishHeader := func() error {
+		if currentFile == nil || !inHeader { return nil }
+		inHeader = false
+		oldName, newName := paths.resolve()
+		currentFile.OldFileName = oldName
+		currentFile.FileName = newName
+		if currentFile.Change == ChangeDeleted { currentFile.FileName = oldName }
+		if len(currentFile.FileName) == 0 {
+			return diffParseErrorAt(headerLineIndex, "could not find a file name in the diff header")
+		}
+		files = append(files, currentFile)
+		return nil
+	}
+
+	for i, rawLine := range rawLines {
+		// an empty line in a hunk is a blank context line whose marker was left off (as with
+		// diff.suppressBlankEmpty); git never produces them anywhere else, but they're harmless
+		inHunk := currentHunk != nil && !hunkState.finished()
+		if len(rawLine) == 0 && !inHunk { continue }
+
+		if isFileHeader(rawLine) {
+			err := finishHeader()
+			if err != nil {
+				return nil, err
+			}
+
+			oldName, newName, err := parseFileHeaderPaths(rawLine)
+			if err != nil {
+				return nil, diffParseErrorAt(i, err.Error())
+			}
+			headerLineIndex = i
+
+			currentFile = &diffFile{
+				Change: ChangeModified,
+				Indents: IndentUnknown,
+				ChangedLines: make([]diffLine, 0),
+			}
+			currentHunk = nil
+			paths = diffPaths{fromGitHeader: [2]string{oldName, newName}}
+			inHeader = true
+			continue
+		}
+
+		// git mentions unmerged paths (during a conflicted merge) without any diff for them
+		if strings.HasPrefix(rawLine, "* Unmerged path ") {
+			err := finishHeader()
+			if err != nil {
+				return nil, err
+			}
+			currentFile = nil
+			currentHunk = nil
+			continue
+		}
+
+		if currentFile == nil { continue } // anything before the first file header
+
+		isHunkHeader := strings.HasPrefix(rawLine, "@@")
+		if inHeader && !isHunkHeader {
+			parseExtendedHeader(rawLine, currentFile, &paths)
+			continue
+		}
+
+		if isHunkHeader {
+			err := finishHeader()
+			if err != nil {
+				return nil, err
+			}
+			hunk, err := parseHunkHeader(rawLine)
+			if err != nil {
+				return nil, diffParseErrorAt(i, err.Error())
+			}
+			currentFile.Hunks = append(currentFile.Hunks, hunk)
+			currentHunk = &currentFile.Hunks[len(currentFile.Hunks) - 1]
+			hunkState = newHunkCursor(hunk)
+			continue
+		}
+
+		if currentHunk == nil {
+			return nil, diffParseErrorAt(i, "content outside of any hunk")
+		}
+
+		if len(rawLine) == 0 { rawLine = strings.Repeat(" ", hunkState.parentCount()) }
+
+		// "\ No newline at end of file" applies to the line before it
+		if rawLine[0] == '\\' {
+			if len(currentHunk.Lines) > 0 {
+				lastLine := &currentHunk.Lines[len(currentHunk.Lines) - 1]
+				lastLine.NoNewlineAtEnd = true
+				lastLine.LineEnding = LineEndingNone
+				lastChanged := len(currentFile.ChangedLines) - 1
+				if lastLine.Kind == LineAdded && lastChanged >= 0 {
+					currentFile.ChangedLines[lastChanged].LineEnding = LineEndingNone
+				}
+			}
+			continue
+		}
+
+		line, err := hunkState.next(rawLine)
+		if err != nil {
+			return nil, diffParseErrorAt(i, err.Error())
+		}
+		// each raw line ended in a newline, so a carriage return before it makes a CRLF ending
+		line.LineEnding = LineEndingLF
+		if content, hasCR := strings.CutSuffix(line.Content, "\r"); hasCR {
+			line.Content = content
+			line.LineEnding = LineEndingCRLF
+		}
+		currentHunk.Lines = append(currentHunk.Lines, line)
+		if line.Kind == LineAdded {
+			currentFile.ChangedLines = append(currentFile.ChangedLines, diffLine{
+				LineNumber: line.NewLineNumber,
+				Indents: whichLineIndents([]rune(line.Content)),
+				Content: line.Content,
+				LineEnding: line.LineEnding,
+			})
+		}
+	}
+	err := finishHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	fileSlice := make([]diffFile, 0, len(files))
+	for _, file := range files {
+		fileSlice = append(fileSlice, *file)
+	}
+
+	return fileSlice, nil
+}
+
+func diffParseErrorAt(lineIndex int, message string) error {
+	return &DiffParseError{Line: lineIndex + 1, Message: message}
+}
+
+func isFileHeader(rawLine string) bool {
+	return strings.HasPrefix(rawLine, "diff --git ") ||
+		strings.HasPrefix(rawLine, "diff --cc ") ||
+		strings.HasPrefix(rawLine, "diff --combined ")
+}
+
+func parseFileHeaderPaths(rawLine string) (string, string, error) {
+	rest, isGitHeader := strings.CutPrefix(rawLine, "diff --git ")
+	if isGitHeader {
+		// a header which can't be split is fine as long as later header lines name the paths
+		oldName, newName, _ := parseGitHeaderPaths(rest)
+		return oldName, newName, nil
+	}
+
+	// combined diffs (of merges) name a single path, without any prefix
+	_, rest, _ = strings.Cut(rawLine[len("diff --"):], " ")
+	path, err := unquoteDiffPath(rest)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed path in combined diff header: %w", err)
+	}
+	return path, path, nil
+}
+
+// Hunk headers look like "@@ -oldStart[,oldCount] +newStart[,newCount] @@ section". Combined diffs
+// of a merge with N parents have N+1 "@" characters on each side, and N old ranges.
+func parseHunkHeader(rawLine string) (diffHunk, error) {
+	markerLength := 0
+	for markerLength < len(rawLine) && rawLine[markerLength] == '@' {
+		markerLength++
+	}
+	if markerLength < 2 {
+		return diffHunk{}, fmt.Errorf("malformed hunk header")
+	}
+	parentCount := markerLength - 1
+	marker := rawLine[:markerLength]
+
+	rest, hasSpace := strings.CutPrefix(rawLine[markerLength:], " ")
+	if !hasSpace {
+		return diffHunk{}, fmt.Errorf("malformed hunk header")
+	}
+	rawRanges, section, hasEnd := strings.Cut(rest, " " + marker)
+	if !hasEnd {
+		return diffHunk{}, fmt.Errorf("unterminated hunk header")
+	}
+	if len(section) > 0 {
+		section, hasSpace = strings.CutPrefix(section, " ")
+		if !hasSpace {
+			return diffHunk{}, fmt.Errorf("malformed hunk header")
+		}
+	}
+
+	rangeFields := strings.Split(rawRanges, " ")
+	if len(rangeFields) != parentCount + 1 {
+		return diffHunk{}, fmt.Errorf(
+			"hunk header has %d ranges, expected %d",
+			len(rangeFields), parentCount + 1,
+		)
+	}
+
+	// the section is a line from the file, which may well have had a CRLF ending
+	section = strings.TrimSuffix(section, "\r")
+	hunk := diffHunk{Section: section, Lines: make([]hunkLine, 0)}
+	for i, rangeField := range rangeFields {
+		expectedSign := byte('-')
+		if i == parentCount { expectedSign = '+' }
+
+		start, count, err := parseHunkRange(rangeField, expectedSign)
+		if err != nil {
+			return diffHunk{}, fmt.Errorf("%w in hunk header", err)
+		}
+		switch {
+			case i == 0:
+				hunk.OldStart, hunk.OldCount = start, count
+			case i == parentCount:
+				hunk.NewStart, hunk.NewCount = start, count
+			default:
+				hunk.OtherParents = append(hunk.OtherParents, hunkRange{Start: start, Count: count})
+		}
+	}
+	return hunk, nil
+}
+
+// A range looks like "-start[,count]" or "+start[,count]". An omitted count is 1.
+func parseHunkRange(rawRange string, expectedSign byte) (uint, uint, error) {
+	if len(rawRange) == 0 || rawRange[0] != expectedSign {
+		return 0, 0, fmt.Errorf("range does not start with '%c'", expectedSign)
+	}
+	rawStart, rawCount, hasCount := strings.Cut(rawRange[1:], ",")
+
+	start, err := parseHunkNumber(rawStart)
+	if err != nil {
+		return 0, 0, err
+	}
+	count := uint(1)
+	if hasCount {
+		count, err = parseHunkNumber(rawCount)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, count, nil
+}
+
+func parseHunkNumber(raw string) (uint, error) {
+	// ParseUint accepts things like underscores which git would never produce
+	for _, ch := range raw {
+		if ch < '0' || ch > '9' { return 0, fmt.Errorf("invalid number") }
+	}
+	number, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number")
+	}
+	return uint(number), nil
+}
+
+// Tracks line numbers through the content of a hunk, and how much of the hunk is left.
+type hunkCursor struct {
+	// the next line number on each side: one per parent, and finally the new file
+	lineNumbers []uint
+	remaining []uint
+}
+
+func newHunkCursor(hunk diffHunk) hunkCursor {
+	cursor := hunkCursor{}
+	cursor.lineNumbers = append(cursor.lineNumbers, hunk.OldStart)
+	cursor.remaining = append(cursor.remaining, hunk.OldCount)
+	for _, parent := range hunk.OtherParents {
+		cursor.lineNumbers = append(cursor.lineNumbers, parent.Start)
+		cursor.remaining = append(cursor.remaining, parent.Count)
+	}
+	cursor.lineNumbers = append(cursor.lineNumbers, hunk.NewStart)
+	cursor.remaining = append(cursor.remaining, hunk.NewCount)
+	return cursor
+}
+
+func (cursor *hunkCursor) parentCount() int {
+	return len(cursor.lineNumbers) - 1
+}
+
+// Whether every line the hunk's header promised has been consumed.
+func (cursor *hunkCursor) finished() bool {
+	for _, remaining := range cursor.remaining {
+		if remaining > 0 { return false }
+	}
+	return true
+}
+
+// Consume a content line of the hunk. Each content line starts with one marker per parent: '+' if
+// the line is in the new file but not that parent, '-' if it's in that parent but not the new
+// file, and ' ' otherwise.
+func (cursor *hunkCursor) next(rawLine string) (hunkLine, error) {
+	parentCount := cursor.parentCount()
+	if len(rawLine) < parentCount {
+		return hunkLine{}, fmt.Errorf("content line is missing its markers")
+	}
+	markers := rawLine[:parentCount]
+
+	inNewFile := true
+	anyAdded := false
+	for _, marker := range []byte(markers) {
+		switch marker {
+			case ' ':
+			case '+': anyAdded = true
+			case '-': inNewFile = false
+			default:
+				return hunkLine{}, fmt.Errorf("content line did not start with one of [ -+\\]")
+		}
+	}
+	if !inNewFile && anyAdded {
+		return hunkLine{}, fmt.Errorf("content line is both added and removed")
+	}
+
+	line := hunkLine{Kind: LineContext, Content: rawLine[parentCount:]}
+	if anyAdded { line.Kind = LineAdded }
+	if !inNewFile { line.Kind = LineRemoved }
+
+	for i, marker := range []byte(markers) {
+		inParent := marker == '-' || (inNewFile && marker != '+')
+		if !inParent { continue }
+		if cursor.remaining[i] == 0 {
+			return hunkLine{}, fmt.Errorf("hunk has more lines than its header says")
+		}
+		if i == 0 { line.OldLineNumber = cursor.lineNumbers[i] }
+		cursor.lineNumbers[i]++
+		cursor.remaining[i]--
+	}
+	if inNewFile {
+		if cursor.remaining[parentCount] == 0 {
+			return hunkLine{}, fmt.Errorf("hunk has more lines than its header says")
+		}
+		line.NewLineNumber = cursor.lineNumbers[parentCount]
+		cursor.lineNumbers[parentCount]++
+		cursor.remaining[parentCount]--
+	}
+	return line, nil
+}
+
+// Extended header lines we don't care about (such as "index" and "similarity index") are ignored.
+func parseExtendedHeader(rawLine string, file *diffFile, paths *diffPaths) {
+	setPath := func(pathIndex int, raw string, target *[2]string, stripPrefix bool) {
+		path, err := unquoteDiffPath(raw)
+		if err != nil { return }
+		if path == "/dev/null" { return }
+		if stripPrefix {
+			path = stripDiffPrefix(path)
+		}
+		target[pathIndex] = path
+	}
+
+	switch {
+		case strings.HasPrefix(rawLine, "new file mode "):
+			file.Change = ChangeAdded
+			file.NewMode = strings.TrimPrefix(rawLine, "new file mode ")
+		case strings.HasPrefix(rawLine, "deleted file mode "):
+			file.Change = ChangeDeleted
+			file.OldMode = strings.TrimPrefix(rawLine, "deleted file mode ")
+		case strings.HasPrefix(rawLine, "old mode "):
+			file.OldMode = strings.TrimPrefix(rawLine, "old mode ")
+		case strings.HasPrefix(rawLine, "new mode "):
+			file.NewMode = strings.TrimPrefix(rawLine, "new mode ")
+		case strings.HasPrefix(rawLine, "index "):
+			// "index abc123..def456 100644" has a mode only when it's the same on both sides
+			fields := strings.Fields(rawLine)
+			if len(fields) == 3 {
+				file.OldMode = fields[2]
+				file.NewMode = fields[2]
+			}
+		case strings.HasPrefix(rawLine, "Binary files "):
+			file.Binary = true
+		case strings.HasPrefix(rawLine, "rename from "):
+			file.Change = ChangeRenamed
+			setPath(0, strings.TrimPrefix(rawLine, "rename from "), &paths.fromRenameOrCopy, false)
+		case strings.HasPrefix(rawLine, "rename to "):
+			setPath(1, strings.TrimPrefix(rawLine, "rename to "), &paths.fromRenameOrCopy, false)
+		case strings.HasPrefix(rawLine, "copy from "):
+			file.Change = ChangeCopied
+			setPath(0, strings.TrimPrefix(rawLine, "copy from "), &paths.fromRenameOrCopy, false)
+		case strings.HasPrefix(rawLine, "copy to "):
+			setPath(1, strings.TrimPrefix(rawLine, "copy to "), &paths.fromRenameOrCopy, false)
+		case strings.HasPrefix(rawLine, "--- "):
+			setPath(0, trimMarkerPath(rawLine), &paths.fromMarkers, true)
+		case strings.HasPrefix(rawLine, "+++ "):
+			setPath(1, trimMarkerPath(rawLine), &paths.fromMarkers, true)
+	}
+}
+
+// Git terminates "---" and "+++" paths which contain spaces with a tab, so that they're unambiguous.
+func trimMarkerPath(rawLine string) string {
+	return strings.TrimSuffix(rawLine[4:], "\t")
+}
+
+// Git quotes paths containing unusual characters (control characters, quotes, backslashes, and
+// with core.quotePath, any non-ASCII bytes) as C-style strings, with octal escapes for bytes.
+// Go's string literal syntax is a superset of that style, so strconv does the work.
+func unquoteDiffPath(raw string) (string, error) {
+	if !strings.HasPrefix(raw, `"`) { return raw, nil }
+	return strconv.Unquote(raw)
+}
+
+// Diffs are always requested with "a/" and "b/" prefixes on paths.
+func stripDiffPrefix(path string) string {
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") { return path[2:] }
+	return path
+}
+
+// Parse the two paths from the remainder of a "diff --git " line. Either path may be quoted.
+// When neither is quoted and the paths contain spaces, the split between them is ambiguous; in
+// that case the paths are assumed to be the same (as they are for everything but renames and
+// copies, which have their own header lines naming the paths unambiguously).
+func parseGitHeaderPaths(rest string) (string, string, error) {
+	var rawOld, rawNew string
+	if strings.HasPrefix(rest, `"`) {
+		end := quotedPrefixLength(rest)
+		if end < 0 || end >= len(rest) || rest[end] != ' ' {
+			return "", "", fmt.Errorf("unterminated quoted path")
+		}
+		rawOld, rawNew = rest[:end], rest[end+1:]
+	} else if quoteStart := strings.Index(rest, ` "`); quoteStart >= 0 {
+		rawOld, rawNew = rest[:quoteStart], rest[quoteStart+1:]
+	} else {
+		// "a/X b/X": the same path twice, so the split is in the middle
+		if len(rest) % 2 == 0 { return "", "", fmt.Errorf("paths are not identical") }
+		middle := len(rest) / 2
+		rawOld, rawNew = rest[:middle], rest[middle+1:]
+		if stripDiffPrefix(rawOld) != stripDiffPrefix(rawNew) {
+			return "", "", fmt.Errorf("paths are not identical")
+		}
+	}
+
+	oldPath, err := unquoteDiffPath(rawOld)
+	if err != nil { return "", "", err }
+	newPath, err := unquoteDiffPath(rawNew)
+	if err != nil { return "", "", err }
+	return stripDiffPrefix(oldPath), stripDiffPrefix(newPath), nil
+}
+
+// The length of the quoted string at the start of s (including both quotes), or -1 if the string
+// is never closed.
+func quotedPrefixLength(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+			case '\\': i++
+			case '"': return i + 1
+		}
+	}
+	return -1
+}
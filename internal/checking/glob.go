@@ -0,0 +1,44 @@
+package checking
+
+import (
+	"path"
+	"strings"
+)
+
+// Whether a repository path matches a glob, in the style of .gitignore: a pattern without a slash
+// matches a file name in any directory, "**" matches any number of directories, and otherwise
+// each segment is matched as by path.Match. Malformed patterns match nothing.
+func matchesGlob(pattern string, filePath string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(filePath))
+		return matched
+	}
+	// a trailing slash means everything in a directory
+	if strings.HasSuffix(pattern, "/") { pattern += "**" }
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(filePath, "/"))
+}
+
+func matchSegments(patterns []string, segments []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(patterns[1:], segments[skip:]) { return true }
+			}
+			return false
+		}
+
+		if len(segments) == 0 { return false }
+		matched, err := path.Match(patterns[0], segments[0])
+		if err != nil || !matched { return false }
+		patterns, segments = patterns[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+func matchesAnyGlob(patterns []string, filePath string) bool {
+	for _, pattern := range patterns {
+		if matchesGlob(pattern, filePath) { return true }
+	}
+	return false
+}
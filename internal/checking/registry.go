@@ -0,0 +1,284 @@
+package checking
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/config"
+)
+
+type Severity int
+const (
+	SeverityNote Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (sev Severity) String() string {
+	switch sev {
+		case SeverityNote: return "note"
+		case SeverityWarning: return "warning"
+		case SeverityError: return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", sev)
+}
+
+func (sev Severity) MarshalText() ([]byte, error) {
+	if sev < SeverityNote || sev > SeverityError {
+		return nil, fmt.Errorf("Invalid Severity value %d", sev)
+	}
+	return []byte(sev.String()), nil
+}
+
+func ParseSeverity(raw string) (Severity, error) {
+	switch strings.ToLower(raw) {
+		case "note": return SeverityNote, nil
+		case "warning", "warn": return SeverityWarning, nil
+		case "error": return SeverityError, nil
+	}
+	return SeverityNote, fmt.Errorf(
+		"Invalid severity \"%s\": must be one of \"error\", \"warning\", or \"note\"",
+		raw,
+	)
+}
+
+// A Check looks over the gathered state of the repository and flags anything worth reporting.
+// CheckRepo is called once per run, CheckFile once for each file in the diff, and CheckLine once
+// for each added line. Checks which have no use for one of these hooks can embed noHooks.
+type Check interface {
+	Name() string
+	Description() string
+	DefaultSeverity() Severity
+	CheckRepo(data *checkData, out *flagSink)
+	CheckFile(file *diffFile, out *flagSink)
+	CheckLine(file *diffFile, line *diffLine, out *flagSink)
+}
+
+type noHooks struct{}
+
+func (noHooks) CheckRepo(data *checkData, out *flagSink) {}
+func (noHooks) CheckFile(file *diffFile, out *flagSink) {}
+func (noHooks) CheckLine(file *diffFile, line *diffLine, out *flagSink) {}
+
+// Checks which find things in added lines which must never be shown (such as secrets) see each
+// file's added lines before any other check does, and mask what they find in the lines' content.
+// Flags from every other check then only ever carry the masked lines.
+type lineRedactor interface {
+	redactLines(file *diffFile, out *flagSink)
+}
+
+// Checks which take check-specific settings produce a configured copy of themselves, leaving the
+// registered (default) instance untouched.
+type configurable interface {
+	configure(settings config.Settings) (Check, error)
+}
+
+// Every check which is run by CheckChanges, in the order they are run. Adding a new check only
+// requires adding it here.
+var registeredChecks = []Check{
+	stashCheck{},
+	indentCheck{},
+	defaultKeywordCheck,
+	conflictMarkerCheck{},
+	defaultSecretCheck,
+	trailingWhitespaceCheck{},
+	defaultLineEndingCheck,
+	defaultFileGuardCheck,
+}
+
+func RegisteredChecks() []Check {
+	return slices.Clone(registeredChecks)
+}
+
+// Default configuration for every registered check, to be layered under any user configuration.
+func ConfigDefaults() []config.Entry {
+	entries := make([]config.Entry, 0, len(registeredChecks) * 2)
+	for _, check := range registeredChecks {
+		entries = append(
+			entries,
+			config.Entry{
+				Key: checkKey(check, "enabled"),
+				Value: "true",
+				Source: config.SourceDefault,
+			},
+			config.Entry{
+				Key: checkKey(check, "severity"),
+				Value: check.DefaultSeverity().String(),
+				Source: config.SourceDefault,
+			},
+		)
+	}
+	entries = append(entries, keywordConfigDefaults()...)
+	entries = append(entries, whitespaceConfigDefaults()...)
+	entries = append(entries, lineEndingConfigDefaults()...)
+	entries = append(entries, fileGuardConfigDefaults()...)
+	return entries
+}
+
+func checkKey(check Check, name string) string {
+	return "check." + check.Name() + "." + name
+}
+
+// A check ready to run, along with the severity its flags are reported at.
+type configuredCheck struct {
+	check Check
+	severity Severity
+	// when a user explicitly configures a check's severity, it applies to every flag the check
+	// raises, even if the check would normally choose a severity per flag
+	forceSeverity bool
+}
+
+func configureChecks(settings config.Settings) ([]configuredCheck, error) {
+	for _, name := range settings.Subsections("check") {
+		isRegistered := slices.ContainsFunc(
+			registeredChecks,
+			func(check Check) bool { return check.Name() == name },
+		)
+		if !isRegistered {
+			return nil, fmt.Errorf("Configuration refers to unknown check \"%s\"", name)
+		}
+	}
+
+	checks := make([]configuredCheck, 0, len(registeredChecks))
+	for _, check := range registeredChecks {
+		enabled, err := settings.Bool(checkKey(check, "enabled"), true)
+		if err != nil { return nil, err }
+		if !enabled { continue }
+
+		configured := configuredCheck{
+			check: check,
+			severity: check.DefaultSeverity(),
+		}
+
+		severitySetting, hasSeverity := settings.Get(checkKey(check, "severity"))
+		if hasSeverity {
+			configured.severity, err = ParseSeverity(severitySetting.Value())
+			if err != nil {
+				return nil, fmt.Errorf("%w (from %s)", err, severitySetting.Source)
+			}
+			configured.forceSeverity = !severitySetting.IsDefault()
+		}
+
+		if configurableCheck, ok := check.(configurable); ok {
+			configured.check, err = configurableCheck.configure(settings)
+			if err != nil { return nil, err }
+		}
+
+		checks = append(checks, configured)
+	}
+
+	return checks, nil
+}
+
+// The checks which are run with the given settings, in the order they are run.
+func EnabledChecks(settings config.Settings) ([]Check, error) {
+	configured, err := configureChecks(settings)
+	if err != nil { return nil, err }
+	checks := make([]Check, 0, len(configured))
+	for _, check := range configured {
+		checks = append(checks, check.check)
+	}
+	return checks, nil
+}
+
+// Collects flags raised by a single check into a report.
+type flagSink struct {
+	check configuredCheck
+	report *CheckReport
+}
+
+// Record a flag at the check's severity.
+func (sink *flagSink) Flag(flag CheckFlag) {
+	sink.FlagAs(sink.check.severity, flag)
+}
+
+// Record a flag at a specific severity, for checks which decide severity on a per-flag basis.
+func (sink *flagSink) FlagAs(severity Severity, flag CheckFlag) {
+	if sink.check.forceSeverity { severity = sink.check.severity }
+
+	sink.report.Findings = append(
+		sink.report.Findings,
+		Finding{
+			Check: sink.check.check.Name(),
+			Severity: severity,
+			Flag: flag,
+		},
+	)
+}
+
+func runChecks(data checkData, checks []configuredCheck) CheckReport {
+	result := CheckReport{
+		Findings: make([]Finding, 0),
+		Suppressed: make([]Finding, 0),
+		Baselined: make([]Finding, 0),
+	}
+
+	sinks := make([]flagSink, len(checks))
+	for i, check := range checks {
+		sinks[i] = flagSink{
+			check: check,
+			report: &result,
+		}
+	}
+
+	for i := range data.Files {
+		redactFile(&data.Files[i], checks, sinks)
+	}
+
+	for i, check := range checks {
+		check.check.CheckRepo(&data, &sinks[i])
+	}
+
+	for i := range data.Files {
+		file := &data.Files[i]
+		for j, check := range checks {
+			check.check.CheckFile(file, &sinks[j])
+		}
+		if file.TooLarge { continue }
+
+		for k := range file.ChangedLines {
+			line := &file.ChangedLines[k]
+			for j, check := range checks {
+				check.check.CheckLine(file, line, &sinks[j])
+			}
+		}
+	}
+
+	return result
+}
+
+func redactFile(file *diffFile, checks []configuredCheck, sinks []flagSink) {
+	if file.TooLarge { return }
+	original := slices.Clone(file.ChangedLines)
+	for j, check := range checks {
+		redactor, ok := check.check.(lineRedactor)
+		if !ok { continue }
+		redactor.redactLines(file, &sinks[j])
+	}
+	if slices.Equal(original, file.ChangedLines) { return }
+
+	// the same added lines are in the file's hunks, which must match
+	addedContent := make(map[uint]string, len(file.ChangedLines))
+	for _, line := range file.ChangedLines {
+		addedContent[line.LineNumber] = line.Content
+	}
+	for i := range file.Hunks {
+		for k := range file.Hunks[i].Lines {
+			line := &file.Hunks[i].Lines[k]
+			if line.Kind != LineAdded { continue }
+			if content, ok := addedContent[line.NewLineNumber]; ok { line.Content = content }
+		}
+	}
+}
+
+func ChecksHelp() string {
+	var buf strings.Builder
+	_, _ = buf.WriteString("CHECKS\n\n")
+	_, _ = buf.WriteString("The following checks are run (default severity in parentheses):\n")
+	for _, check := range registeredChecks {
+		_, _ = fmt.Fprintf(&buf, "  - %s (%s)\n", check.Name(), check.DefaultSeverity())
+		_, _ = fmt.Fprintf(&buf, "      %s\n", check.Description())
+	}
+	return buf.String()
+}
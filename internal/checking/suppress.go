@@ -0,0 +1,142 @@
+package checking
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Suppression directives can be written anywhere on a line (usually in a comment):
+//
+//	check-changes:ignore[keyword]          suppresses keyword flags on this line and the next
+//	check-changes:ignore[keyword,indent]   multiple checks can be listed
+//	check-changes:ignore                   suppresses flags from every check, except those below
+//	check-changes:ignore-file[indent]      suppresses indent flags anywhere in the file
+var suppressionRegex = regexp.MustCompile(`check-changes:ignore(-file)?(?:\[([^\]]*)\])?`)
+
+type suppression struct {
+	LineNumber uint
+	FileWide bool
+	// An empty list suppresses every check, other than those in namedOnlyChecks.
+	Checks []string
+}
+
+// Checks whose flags block a commit for good reason (a leaked credential, or a botched merge), and
+// so are only suppressed by directives which name them. Otherwise a single bare directive could
+// quietly turn them off for a whole file.
+var namedOnlyChecks = []string{secretCheck{}.Name(), conflictMarkerCheck{}.Name()}
+
+func parseSuppressions(line string, lineNumber uint) []suppression {
+	matches := suppressionRegex.FindAllStringSubmatch(line, -1)
+	suppressions := make([]suppression, 0, len(matches))
+	for _, match := range matches {
+		checks := strings.FieldsFunc(match[2], func(c rune) bool { return c == ',' || c == ' ' })
+		suppressions = append(suppressions, suppression{
+			LineNumber: lineNumber,
+			FileWide: len(match[1]) > 0,
+			Checks: checks,
+		})
+	}
+	return suppressions
+}
+
+func (sup suppression) covers(finding Finding) bool {
+	if len(sup.Checks) == 0 && slices.Contains(namedOnlyChecks, finding.Check) { return false }
+	if len(sup.Checks) > 0 && !slices.Contains(sup.Checks, finding.Check) { return false }
+	if sup.FileWide { return true }
+
+	line := finding.Flag.Location().Line
+	return line == sup.LineNumber || line == sup.LineNumber + 1
+}
+
+func (sup suppression) String() string {
+	kind := "ignore"
+	if sup.FileWide { kind = "ignore-file" }
+	if len(sup.Checks) == 0 { return "check-changes:" + kind }
+	return fmt.Sprintf("check-changes:%s[%s]", kind, strings.Join(sup.Checks, ","))
+}
+
+type UnusedSuppressionFlag struct {
+	FileName string `json:"file"`
+	LineNumber uint `json:"line"`
+	Directive string `json:"directive"`
+}
+
+func (flag UnusedSuppressionFlag) Message() string {
+	return fmt.Sprintf("suppression \"%s\" does not suppress anything", flag.Directive)
+}
+
+func (flag UnusedSuppressionFlag) ContextMsg() string {
+	return ""
+}
+
+func (flag UnusedSuppressionFlag) FingerprintContent() string {
+	return flag.Directive
+}
+
+func (flag UnusedSuppressionFlag) Location() Location {
+	return Location{File: flag.FileName, Line: flag.LineNumber}
+}
+
+// Findings reported for suppressions which didn't suppress anything use this in place of a check
+// name.
+const unusedSuppressionCheck = "unused-suppression"
+
+// Move any suppressed findings out of the report's findings. If requested, suppressions on added
+// lines which didn't suppress anything are reported as warnings. (Suppressions on other lines
+// are left alone, since they may well be suppressing flags which this diff doesn't touch.)
+func applySuppressions(report *CheckReport, files []diffFile, reportUnused bool) {
+	suppressionsByFile := make(map[string][]suppression, len(files))
+	addedLinesByFile := make(map[string]map[uint]struct{}, len(files))
+	for _, file := range files {
+		suppressionsByFile[file.FileName] = file.Suppressions
+		addedLines := make(map[uint]struct{}, len(file.ChangedLines))
+		for _, line := range file.ChangedLines {
+			addedLines[line.LineNumber] = struct{}{}
+		}
+		addedLinesByFile[file.FileName] = addedLines
+	}
+
+	type suppressionKey struct {
+		file string
+		index int
+	}
+	used := make(map[suppressionKey]struct{})
+
+	kept := make([]Finding, 0, len(report.Findings))
+	for _, finding := range report.Findings {
+		file := finding.Flag.Location().File
+		isSuppressed := false
+		for i, sup := range suppressionsByFile[file] {
+			if sup.covers(finding) {
+				isSuppressed = true
+				used[suppressionKey{file, i}] = struct{}{}
+			}
+		}
+
+		if isSuppressed {
+			report.Suppressed = append(report.Suppressed, finding)
+		} else {
+			kept = append(kept, finding)
+		}
+	}
+	report.Findings = kept
+
+	if !reportUnused { return }
+	for _, file := range files {
+		for i, sup := range file.Suppressions {
+			if _, isUsed := used[suppressionKey{file.FileName, i}]; isUsed { continue }
+			if _, isAdded := addedLinesByFile[file.FileName][sup.LineNumber]; !isAdded { continue }
+			report.Findings = append(report.Findings, Finding{
+				Check: unusedSuppressionCheck,
+				Severity: SeverityWarning,
+				Flag: UnusedSuppressionFlag{
+					FileName: file.FileName,
+					LineNumber: sup.LineNumber,
+					Directive: sup.String(),
+				},
+			})
+		}
+	}
+}
@@ -2,19 +2,26 @@ package config
 
 import (
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 )
 
-// TODO: add some testing in here
-
 type Opts struct {
 	HelpRequested bool
 	HideContext bool
 	RawRevs string
 	ParsedRevs []string
+	PerCommit bool
+	Format string
+	Sort string
+	Color string
+	ShowSuppressed bool
+	ReportUnusedSuppressions bool
+	BaselineFile string
+	Timeout time.Duration
+	Settings Settings
 }
 
 func Default() Opts {
@@ -43,21 +50,149 @@ func InitOpts(opts *Opts) *pflag.FlagSet {
 		opts.RawRevs,
 		rawRevsHelp,
 	)
+	flags.BoolVar(
+		&opts.PerCommit,
+		"per-commit",
+		opts.PerCommit,
+		perCommitHelp,
+	)
+	flags.StringVar(
+		&opts.Format,
+		"format",
+		opts.Format,
+		formatHelp,
+	)
+	flags.StringVar(
+		&opts.Sort,
+		"sort",
+		opts.Sort,
+		sortHelp,
+	)
+	flags.BoolVar(
+		&opts.ShowSuppressed,
+		"show-suppressed",
+		opts.ShowSuppressed,
+		"Also print issues which were suppressed by check-changes:ignore directives",
+	)
+	flags.BoolVar(
+		&opts.ReportUnusedSuppressions,
+		"report-unused-suppressions",
+		opts.ReportUnusedSuppressions,
+		"Warn about check-changes:ignore directives in added lines which suppress nothing",
+	)
+	flags.StringVar(
+		&opts.BaselineFile,
+		"baseline",
+		opts.BaselineFile,
+		baselineHelp,
+	)
+	flags.StringVar(
+		&opts.Color,
+		"color",
+		opts.Color,
+		colorHelp,
+	)
+	flags.DurationVar(
+		&opts.Timeout,
+		"timeout",
+		opts.Timeout,
+		timeoutHelp,
+	)
 
 	return flags
 }
 
+// Config keys which correspond to command-line options are named after the option.
+const optionSection string = "check-changes"
+const noContextKey string = optionSection + ".no-context"
+const rawRevsKey string = optionSection + ".revs"
+const perCommitKey string = optionSection + ".per-commit"
+const formatKey string = optionSection + ".format"
+const sortKey string = optionSection + ".sort"
+const colorKey string = optionSection + ".color"
+const showSuppressedKey string = optionSection + ".show-suppressed"
+const reportUnusedKey string = optionSection + ".report-unused-suppressions"
+const baselineKey string = optionSection + ".baseline"
+const timeoutKey string = optionSection + ".timeout"
+
+var optionDefaults = []Entry{
+	{ Key: noContextKey, Value: "false", Source: SourceDefault },
+	{ Key: rawRevsKey, Value: "", Source: SourceDefault },
+	{ Key: perCommitKey, Value: "false", Source: SourceDefault },
+	{ Key: formatKey, Value: "text", Source: SourceDefault },
+	{ Key: sortKey, Value: "file", Source: SourceDefault },
+	{ Key: colorKey, Value: "auto", Source: SourceDefault },
+	{ Key: showSuppressedKey, Value: "false", Source: SourceDefault },
+	{ Key: reportUnusedKey, Value: "false", Source: SourceDefault },
+	{ Key: baselineKey, Value: ".git-corpa-baseline.json", Source: SourceDefault },
+	{ Key: timeoutKey, Value: "0s", Source: SourceDefault },
+}
+
 const envPrefix string = "CHCK_CHNG_"
 const rawRevsEnv string = envPrefix + "REVS"
 
-func ApplyEnv(opts *Opts) {
-	opts.RawRevs = os.Getenv(rawRevsEnv)
+var envKeys = map[string]string {
+	rawRevsEnv: rawRevsKey,
 }
 
 const rawRevsHelp string =
 	`An optional git rev to diff against. You may pass a list of revs, separated by colons (:).
 	The first valid rev will be used.
-	If no valid rev is matched, the diff used will be as \"git diff\" with no arguments.`
+	Staged changes are diffed against the rev.
+	If no valid rev is matched, staged changes will be diffed against HEAD.`
+
+const perCommitHelp string =
+	`Check each commit between the rev (see --revs) and HEAD against its own changes, rather than
+	checking staged changes. Issues are reported by the commit which introduced them, and issues
+	which a later commit fixed are reported separately. Only "text" and "json" output is supported.`
+
+const formatHelp string =
+	`Output format for flagged issues (default "text"). One of:
+	"text", "json", "sarif", "junit", or "checkstyle"`
+
+const sortHelp string =
+	`Order of flagged issues (default "file"). One of:
+	"file" (by path, then line), "severity" (most severe first), or "check" (by check name)`
+
+const baselineHelp string =
+	`Path (relative to the repository root) of the baseline file (default ".git-corpa-baseline.json").
+	Issues recorded in the baseline are not reported. Run "check-changes baseline" to record all
+	current issues. An empty path disables the baseline.`
+
+const colorHelp string =
+	`When to group text output by file and colorize it (default "auto"). One of:
+	"auto" (only when standard output is a terminal), "always", or "never".
+	With "auto", color is turned off if the NO_COLOR environment variable is set.`
+
+const timeoutHelp string =
+	`How long to wait for git before giving up, such as "30s" or "2m" (default "0s", which means
+	waiting as long as it takes)`
+
+// Read the settings out into the typed fields of the Opts.
+func (opts *Opts) decode() error {
+	hideContext, err := opts.Settings.Bool(noContextKey, false)
+	if err != nil { return err }
+	opts.HideContext = hideContext
+	opts.RawRevs = opts.Settings.String(rawRevsKey)
+	opts.ParseRevs()
+	opts.PerCommit, err = opts.Settings.Bool(perCommitKey, false)
+	if err != nil { return err }
+	opts.Format = opts.Settings.String(formatKey)
+	opts.Sort = opts.Settings.String(sortKey)
+	opts.Color = opts.Settings.String(colorKey)
+	opts.BaselineFile = opts.Settings.String(baselineKey)
+	opts.Timeout, err = time.ParseDuration(opts.Settings.String(timeoutKey))
+	if err != nil {
+		return fmt.Errorf("Invalid value for %s: %w", timeoutKey, err)
+	}
+
+	opts.ShowSuppressed, err = opts.Settings.Bool(showSuppressedKey, false)
+	if err != nil { return err }
+	opts.ReportUnusedSuppressions, err = opts.Settings.Bool(reportUnusedKey, false)
+	if err != nil { return err }
+
+	return nil
+}
 
 func (opts *Opts) ParseRevs() {
 	opts.ParsedRevs = strings.Split(opts.RawRevs, ":")
@@ -75,3 +210,51 @@ The following environment variables are available:
 
 	return fmt.Sprintf(text, rawRevsEnv)
 }
+
+func ConfigHelp() string {
+	text := `CONFIGURATION
+
+Configuration is read from the following sources, with later sources taking
+precedence over earlier ones:
+  - a user config file at $XDG_CONFIG_HOME/%[1]s (or ~/.config/%[1]s)
+  - a repository config file named %[2]s at the root of the repository
+  - keys in git's own configuration prefixed with "%[3]s", for example
+    "git config %[3]scheck.indent.severity warning"
+  - environment variables
+  - command-line options
+
+Config files use the same syntax as git config files. Available keys:
+  - %[4]s.<option>: any command-line option (other than help), for
+    example "%[5]s"
+  - check.<name>.enabled: set to false to skip a check
+  - check.<name>.severity: one of "error", "warning", or "note"
+  - keywords.error, keywords.warning: keywords for the keyword check (may be
+    given multiple times; replaces the default keywords)
+  - keyword.<name>.severity, keyword.<name>.pattern, keyword.<name>.regex,
+    keyword.<name>.ignoreCase, keyword.<name>.message, keyword.<name>.enabled:
+    a keyword with its own options; pattern defaults to the name, and is
+    matched literally unless regex is true
+  - secret.<name>.pattern, secret.<name>.description, secret.<name>.minEntropy,
+    secret.<name>.enabled: a rule for the secret check, or changes to one of its
+    default rules; a group named "secret" in the pattern marks the secret itself
+  - secrets.allow: a path glob (like a .gitignore pattern) of files which may
+    contain secrets, such as test fixtures (may be given multiple times)
+  - whitespace.<glob>.enabled, whitespace.<glob>.blankLines,
+    whitespace.<glob>.allowHardBreaks: options for the trailing-whitespace
+    check in files matching a path glob; by default, Markdown files allow two
+    or more trailing spaces (a hard line break)
+  - check.line-ending.useAttributes: set to false to judge line endings only by
+    the rest of each file, ignoring the text and eol attributes in .gitattributes
+  - check.file-guard.maxSize: the largest size an added or changed file may be,
+    in bytes or with a "k", "m", or "g" suffix (default "1m"; 0 for no limit)
+  - check.file-guard.allowBinary: a path glob of files which may be binary (may
+    be given multiple times)
+
+Run "check-changes config show" to print the effective configuration and
+where each value came from.`
+
+	return fmt.Sprintf(
+		text,
+		userConfigFile, repoConfigFile, gitConfigPrefix, optionSection, rawRevsKey,
+	)
+}
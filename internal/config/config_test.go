@@ -0,0 +1,84 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLaterLayersReplaceEarlierValues(t *testing.T) {
+	settings := NewSettings([]Entry{
+		{ Key: "keywords.warning", Value: "TODO", Source: SourceDefault },
+		{ Key: "keywords.warning", Value: "FIXME", Source: SourceDefault },
+		{ Key: "check.indent.severity", Value: "error", Source: SourceDefault },
+	})
+	settings.applyLayer([]Entry{
+		{ Key: "keywords.warning", Value: "XXX", Source: "file:.git-corpa" },
+	})
+
+	keywords, _ := settings.Get("keywords.warning")
+	assert.Equal(t, []string{"XXX"}, keywords.Values)
+	assert.Equal(t, "file:.git-corpa", keywords.Source)
+	assert.False(t, keywords.IsDefault())
+
+	severity, _ := settings.Get("check.indent.severity")
+	assert.Equal(t, "error", severity.Value())
+	assert.True(t, severity.IsDefault())
+}
+
+func TestKeysAreNormalizedLikeGit(t *testing.T) {
+	cases := []struct{
+		key string
+		expected string
+	} {
+		{ "Keywords.Warning", "keywords.warning" },
+		{ "CHECK.Indent.Severity", "check.Indent.severity" },
+		{ "corpa.check.My.Check.enabled", "corpa.check.My.Check.enabled" },
+		{ "novalue", "novalue" },
+	}
+
+	for _, testCase := range cases {
+		assert.Equal(t, testCase.expected, normalizeKey(testCase.key))
+	}
+}
+
+func TestBoolValues(t *testing.T) {
+	settings := NewSettings([]Entry{
+		{ Key: "a.yes", Value: "yes" },
+		{ Key: "a.off", Value: "Off" },
+		{ Key: "a.empty", Value: "" },
+		{ Key: "a.bad", Value: "maybe" },
+	})
+
+	value, err := settings.Bool("a.yes", false)
+	assert.Nil(t, err)
+	assert.True(t, value)
+
+	value, err = settings.Bool("a.off", true)
+	assert.Nil(t, err)
+	assert.False(t, value)
+
+	value, err = settings.Bool("a.empty", true)
+	assert.Nil(t, err)
+	assert.False(t, value)
+
+	value, err = settings.Bool("a.missing", true)
+	assert.Nil(t, err)
+	assert.True(t, value)
+
+	_, err = settings.Bool("a.bad", true)
+	assert.NotNil(t, err)
+}
+
+func TestSubsections(t *testing.T) {
+	settings := NewSettings([]Entry{
+		{ Key: "check.keyword.enabled", Value: "true" },
+		{ Key: "check.indent.enabled", Value: "true" },
+		{ Key: "check.indent.severity", Value: "error" },
+		{ Key: "check.nosubsection", Value: "true" },
+		{ Key: "keywords.error", Value: "NOCHECKIN" },
+	})
+
+	assert.Equal(t, []string{"indent", "keyword"}, settings.Subsections("check"))
+	assert.Empty(t, settings.Subsections("keywords"))
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/git"
+	"github.com/spf13/pflag"
+)
+
+const userConfigFile string = "git-corpa/config"
+const repoConfigFile string = ".git-corpa"
+const gitConfigPrefix string = "corpa."
+
+// Merge configuration from every source into opts.Settings, and then into the typed fields of
+// opts. Defaults are provided by the caller, since some of them (such as which checks exist) are
+// not known to this package. Command-line flags must already have been parsed.
+func Load(
+	ctx context.Context,
+	gitClient *git.Client,
+	opts *Opts,
+	flags *pflag.FlagSet,
+	defaults []Entry,
+) error {
+	opts.Settings = NewSettings(optionDefaults)
+	opts.Settings.applyLayer(defaults)
+
+	userFile, hasUserFile := userConfigPath()
+	if hasUserFile {
+		err := applyFileLayer(ctx, gitClient, &opts.Settings, userFile)
+		if err != nil { return err }
+	}
+
+	repoRoot, err := gitClient.RepoRoot(ctx)
+	if err == nil {
+		err := applyFileLayer(ctx, gitClient, &opts.Settings, filepath.Join(repoRoot, repoConfigFile))
+		if err != nil { return err }
+	} else if !errors.Is(err, git.ErrNotARepo) {
+		return err
+	}
+
+	gitConfigRegex := `^` + strings.ReplaceAll(gitConfigPrefix, ".", `\.`)
+	gitEntries, err := gitClient.ConfigEntries(ctx, gitConfigRegex)
+	if err != nil { return err }
+	opts.Settings.applyLayer(fromGitEntries(gitEntries, gitConfigPrefix))
+
+	opts.Settings.applyLayer(envEntries())
+	opts.Settings.applyLayer(flagEntries(flags))
+
+	return opts.decode()
+}
+
+func userConfigPath() (string, bool) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if len(configHome) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil { return "", false }
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, userConfigFile), true
+}
+
+func applyFileLayer(
+	ctx context.Context,
+	gitClient *git.Client,
+	settings *Settings,
+	path string,
+) error {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) { return nil }
+	if err != nil { return err }
+
+	entries, err := gitClient.ConfigFileEntries(ctx, path)
+	if err != nil { return err }
+	settings.applyLayer(fromGitEntries(entries, ""))
+	return nil
+}
+
+func fromGitEntries(gitEntries []git.ConfigEntry, stripPrefix string) []Entry {
+	entries := make([]Entry, 0, len(gitEntries))
+	for _, gitEntry := range gitEntries {
+		entries = append(entries, Entry{
+			Key: strings.TrimPrefix(gitEntry.Key, stripPrefix),
+			Value: gitEntry.Value,
+			Source: gitEntry.Origin,
+		})
+	}
+	return entries
+}
+
+func envEntries() []Entry {
+	entries := make([]Entry, 0)
+	for envVar, key := range envKeys {
+		value := os.Getenv(envVar)
+		if len(value) == 0 { continue }
+		entries = append(entries, Entry{
+			Key: key,
+			Value: value,
+			Source: "env:" + envVar,
+		})
+	}
+	return entries
+}
+
+func flagEntries(flags *pflag.FlagSet) []Entry {
+	entries := make([]Entry, 0)
+	flags.Visit(func(flag *pflag.Flag) {
+		if flag.Name == "help" { return }
+		entries = append(entries, Entry{
+			Key: optionSection + "." + flag.Name,
+			Value: flag.Value.String(),
+			Source: "flag:--" + flag.Name,
+		})
+	})
+	return entries
+}
+
+// Print each effective setting in the same layout as "git config --list --show-origin".
+func ShowConfig(out io.Writer, settings Settings) {
+	for _, setting := range settings.All() {
+		if len(setting.Values) == 0 {
+			fmt.Fprintf(out, "%s\t%s=\n", setting.Source, setting.Key)
+		}
+		for _, value := range setting.Values {
+			fmt.Fprintf(out, "%s\t%s=%s\n", setting.Source, setting.Key, value)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const SourceDefault string = "default"
+
+// A single raw configuration entry, as read from one of the configuration sources.
+type Entry struct {
+	Key string
+	Value string
+	Source string
+}
+
+// The effective value of a configuration key, along with where that value came from. Keys may
+// have multiple values (for lists); single-valued keys use the last value, as git does.
+type Setting struct {
+	Key string
+	Values []string
+	Source string
+}
+
+func (setting Setting) Value() string {
+	if len(setting.Values) == 0 { return "" }
+	return setting.Values[len(setting.Values)-1]
+}
+
+func (setting Setting) IsDefault() bool {
+	return setting.Source == SourceDefault
+}
+
+// Configuration merged from every source. Keys take the form "section.name" or
+// "section.subsection.name". As with git, section and name are case-insensitive but subsection is
+// not.
+type Settings struct {
+	entries map[string]Setting
+}
+
+func NewSettings(entries []Entry) Settings {
+	settings := Settings{entries: make(map[string]Setting)}
+	settings.applyLayer(entries)
+	return settings
+}
+
+// Apply a layer of entries over the current settings. Every value a layer provides for a key
+// replaces all values that lower layers provided for that key.
+func (settings *Settings) applyLayer(entries []Entry) {
+	layer := make(map[string]Setting)
+	keys := make([]string, 0)
+	for _, entry := range entries {
+		key := normalizeKey(entry.Key)
+		setting, exists := layer[key]
+		if !exists {
+			keys = append(keys, key)
+			setting.Key = key
+		}
+		setting.Values = append(setting.Values, entry.Value)
+		setting.Source = entry.Source
+		layer[key] = setting
+	}
+
+	for _, key := range keys {
+		settings.entries[key] = layer[key]
+	}
+}
+
+func (settings Settings) Get(key string) (Setting, bool) {
+	setting, exists := settings.entries[normalizeKey(key)]
+	return setting, exists
+}
+
+func (settings Settings) String(key string) string {
+	setting, _ := settings.Get(key)
+	return setting.Value()
+}
+
+func (settings Settings) Values(key string) []string {
+	setting, _ := settings.Get(key)
+	return slices.Clone(setting.Values)
+}
+
+// Interpret a key's value as a boolean, in the same way git does. Keys which are not set produce
+// the fallback value.
+func (settings Settings) Bool(key string, fallback bool) (bool, error) {
+	setting, exists := settings.Get(key)
+	if !exists { return fallback, nil }
+
+	switch strings.ToLower(setting.Value()) {
+		case "true", "yes", "on", "1": return true, nil
+		case "false", "no", "off", "0", "": return false, nil
+	}
+	return fallback, fmt.Errorf(
+		"Invalid boolean value \"%s\" for config key \"%s\" (from %s)",
+		setting.Value(), setting.Key, setting.Source,
+	)
+}
+
+// The distinct subsections present under a section, sorted. For example, the keys
+// "check.indent.enabled" and "check.keyword.severity" are subsections "indent" and "keyword" of
+// section "check".
+func (settings Settings) Subsections(section string) []string {
+	prefix := strings.ToLower(section) + "."
+	subsections := make([]string, 0)
+	for key := range settings.entries {
+		if !strings.HasPrefix(key, prefix) { continue }
+		lastDot := strings.LastIndex(key, ".")
+		if lastDot < len(prefix) { continue } // no subsection
+		subsection := key[len(prefix):lastDot]
+		if !slices.Contains(subsections, subsection) {
+			subsections = append(subsections, subsection)
+		}
+	}
+	slices.Sort(subsections)
+	return subsections
+}
+
+// Every effective setting, sorted by key.
+func (settings Settings) All() []Setting {
+	all := make([]Setting, 0, len(settings.entries))
+	for _, setting := range settings.entries {
+		all = append(all, setting)
+	}
+	slices.SortFunc(all, func(a, b Setting) int { return strings.Compare(a.Key, b.Key) })
+	return all
+}
+
+func normalizeKey(key string) string {
+	firstDot := strings.Index(key, ".")
+	lastDot := strings.LastIndex(key, ".")
+	if firstDot < 0 { return strings.ToLower(key) }
+
+	section := strings.ToLower(key[:firstDot])
+	name := strings.ToLower(key[lastDot+1:])
+	if firstDot == lastDot { return section + "." + name }
+	return section + key[firstDot:lastDot+1] + name
+}
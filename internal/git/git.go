@@ -1,8 +1,16 @@
 package git
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/lorentzforces/check-changes/internal/platform"
@@ -13,74 +21,423 @@ func ExecExists() bool {
 	return err == nil
 }
 
-var RepoDoesNotExistError = fmt.Errorf("Not inside a git repository")
+var ErrNotARepo = errors.New("Not inside a git repository")
+var ErrBadRev = errors.New("Not a valid git revision")
 
-func RepoRoot() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	cmd.Env = []string{}
+// Runs git commands against a particular repository.
+type Client struct {
+	runner Runner
+	dir string
+}
+
+// A client which runs git in the given directory, or the working directory if dir is empty.
+func NewClient(runner Runner, dir string) *Client {
+	return &Client{runner: runner, dir: dir}
+}
+
+// Runs git with the given arguments.
+func (client *Client) run(ctx context.Context, args ...string) ([]byte, error) {
+	return client.runner.Run(Invocation{
+		Ctx: ctx,
+		Args: args,
+		Env: commandEnv(os.Environ()),
+		Dir: client.dir,
+	})
+}
+
+// The environment git is run with. Everything in the base environment is passed along, so that
+// git's own variables (like GIT_DIR and GIT_INDEX_FILE, which hooks rely on) and the user's
+// configuration are respected. Only what's needed to keep git's output parseable is overridden.
+// (Diff options which could change what a diff contains are also turned off with flags, since
+// there are flags for them.)
+func commandEnv(base []string) []string {
+	env := slices.Clone(base)
+	// messages are matched in a few places, so they can't be translated
+	env = append(env, "LC_ALL=C", "GIT_PAGER=cat", "GIT_TERMINAL_PROMPT=0")
 
-	stdOut, err := cmd.Output()
-	exitErr, isType := err.(*exec.ExitError)
+	// not every command has a flag to turn off color, or to keep blank context lines in diffs from
+	// being emptied out, so these are set in config instead, after any config which is already
+	// being passed in the environment
+	configCount := 0
+	for _, entry := range base {
+		rawCount, isCount := strings.CutPrefix(entry, "GIT_CONFIG_COUNT=")
+		if !isCount { continue }
+		count, err := strconv.Atoi(rawCount)
+		if err == nil && count > 0 { configCount = count }
+	}
+	overrides := []struct{ key, value string } {
+		{ "color.ui", "never" },
+		{ "diff.suppressBlankEmpty", "false" },
+	}
+	env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", configCount + len(overrides)))
+	for i, override := range overrides {
+		env = append(
+			env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", configCount + i, override.key),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", configCount + i, override.value),
+		)
+	}
+	return env
+}
 
-	if isType {
-		stdErr := string(exitErr.Stderr[:])
-		isNoRepoError := strings.Contains(stdErr, "not a git repository")
+func (client *Client) RepoRoot(ctx context.Context) (string, error) {
+	stdOut, err := client.run(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		isNoRepoError := strings.Contains(stderrOf(err), "not a git repository")
 		if isNoRepoError {
-			return "", RepoDoesNotExistError
+			return "", ErrNotARepo
 		}
-		platform.FailOnErr(err)
+		return "", err
 	}
-	platform.FailOnErr(err)
 
 	fullOutput := string(stdOut[:])
 	return strings.TrimRight(fullOutput, "\n\r"), nil
 }
 
 // The current branch name. If in detached head state, returns empty string.
-func CurrentBranch() string {
-	cmd := exec.Command("git", "branch", "--show-current")
-	stdOut, err := cmd.Output()
-	platform.FailOnErr(err)
+func (client *Client) CurrentBranch(ctx context.Context) (string, error) {
+	stdOut, err := client.run(ctx, "branch", "--show-current")
+	if err != nil { return "", err }
 	fullOutput := string(stdOut[:])
-	return strings.TrimRight(fullOutput, "\n\r")
+	return strings.TrimRight(fullOutput, "\n\r"), nil
 }
 
-// returns whether the passed rev name resolves to a commit
-func ValidRev(revName string) bool {
-	cmd := exec.Command("git", "rev-parse", "--verify", revName)
-	err := cmd.Run()
-	return err == nil
+// returns whether the passed rev name resolves to a commit; an error means git couldn't say
+// (because it timed out, for instance), not that the rev is invalid
+func (client *Client) ValidRev(ctx context.Context, revName string) (bool, error) {
+	_, err := client.run(ctx, "rev-parse", "--verify", "--quiet", revName)
+	if err == nil { return true, nil }
+
+	// with --quiet, a rev which doesn't resolve is only reported by the exit status
+	cmdErr := &CommandError{}
+	if errors.As(err, &cmdErr) && cmdErr.ExitCode == 1 { return false, nil }
+	if strings.Contains(stderrOf(err), "not a git repository") { return false, ErrNotARepo }
+	return false, err
 }
 
-func FirstValidRev(revs []string) (string, error) {
+// Errors other than ErrBadRev mean that not every rev could be checked.
+func (client *Client) FirstValidRev(ctx context.Context, revs []string) (string, error) {
 	for _, rev := range revs {
-		if ValidRev(rev) { return rev, nil }
+		valid, err := client.ValidRev(ctx, rev)
+		if err != nil { return "", err }
+		if valid { return rev, nil }
 	}
 
-	return "", fmt.Errorf("None of the revs provided resolved to a valid git object")
+	return "", fmt.Errorf("%w: none of the revs provided resolved to a valid git object", ErrBadRev)
 }
 
-func StashEntries() []string {
-	cmd := exec.Command("git", "stash", "list")
-	cmd.Env = []string{}
-	stdOut, err := cmd.Output()
-	platform.FailOnErr(err)
+func (client *Client) StashEntries(ctx context.Context) ([]string, error) {
+	stdOut, err := client.run(ctx, "stash", "list")
+	if err != nil { return nil, err }
 
 	fullOutput := string(stdOut[:])
-	return platform.SplitLines(fullOutput)
+	return platform.SplitLines(fullOutput), nil
+}
+
+// Options for every diff, so that the user's configuration can't change (or hide) what's in one:
+// external diff tools and textconv filters would replace the patch, and diff.relative would leave
+// out changes outside the working directory.
+var diffOptions = []string{
+	"--no-color", "--no-ext-diff", "--no-textconv", "--no-relative", "-p",
+	"--src-prefix=a/", "--dst-prefix=b/",
 }
 
-// If ref is a non-empty string, diff against whatever ref that is.
-// If empty, then just diff against HEAD (only index/staged changes)
-func Diff(ref string) []string {
+// Diffs the index (staged changes) against a ref. If ref is a non-empty string, diff against
+// whatever ref that is. If empty, then just diff against HEAD.
+func (client *Client) Diff(ctx context.Context, ref string) ([]string, error) {
 	refForDiff := ref
 	if len(refForDiff) == 0 { refForDiff = "HEAD" }
 
-	cmd := exec.Command("git", "diff", "--no-color", "-p", refForDiff)
-	cmd.Env = []string{}
-	stdOut, err := cmd.Output()
-	platform.FailOnErr(err)
+	args := append([]string{"diff", "--cached"}, diffOptions...)
+	stdOut, err := client.run(ctx, append(args, refForDiff)...)
+	if err != nil {
+		if isBadRevError(stderrOf(err)) {
+			return nil, fmt.Errorf("%w \"%s\": %w", ErrBadRev, refForDiff, err)
+		}
+		return nil, err
+	}
 
+	// the content of lines is passed along as is, line endings included
 	fullOutput := string(stdOut[:])
-	return platform.SplitLines(fullOutput)
+	return platform.SplitNewlines(fullOutput), nil
+}
+
+// Diffs two commits (or trees). If from is empty, to is diffed against nothing at all, as for a
+// root commit.
+func (client *Client) TreeDiff(ctx context.Context, from string, to string) ([]string, error) {
+	args := append([]string{"diff-tree", "-r", "-M"}, diffOptions...)
+	if len(from) == 0 {
+		args = append(args, "--root", "--no-commit-id", to)
+	} else {
+		args = append(args, from, to)
+	}
+
+	stdOut, err := client.run(ctx, args...)
+	if err != nil {
+		if isBadRevError(stderrOf(err)) {
+			return nil, fmt.Errorf("%w \"%s\" or \"%s\": %w", ErrBadRev, from, to, err)
+		}
+		return nil, err
+	}
+
+	fullOutput := string(stdOut[:])
+	return platform.SplitNewlines(fullOutput), nil
+}
+
+type Commit struct {
+	ID string
+	Subject string
+	// Empty for root commits.
+	Parents []string
+}
+
+// The commits reachable from HEAD but not from base, oldest first. Merge commits are left out,
+// since the changes they bring in are made by the commits being merged (aside from any conflict
+// resolutions).
+func (client *Client) RevList(ctx context.Context, base string) ([]Commit, error) {
+	stdOut, err := client.run(
+		ctx,
+		"rev-list", "--reverse", "--no-merges", "--format=%H%x00%P%x00%s", base + "..HEAD",
+	)
+	if err != nil {
+		if isBadRevError(stderrOf(err)) {
+			return nil, fmt.Errorf("%w \"%s\": %w", ErrBadRev, base, err)
+		}
+		return nil, err
+	}
+
+	return parseRevList(string(stdOut))
+}
+
+var revListParseError = fmt.Errorf("An error was encountered while parsing git rev-list output")
+
+// format: each commit is a "commit <id>" line, followed by a line in the requested format
+func parseRevList(output string) ([]Commit, error) {
+	commits := make([]Commit, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) == 0 || strings.HasPrefix(line, "commit ") { continue }
+
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%w: malformed line \"%s\"", revListParseError, line)
+		}
+		commits = append(commits, Commit{
+			ID: fields[0],
+			Parents: strings.Fields(fields[1]),
+			Subject: fields[2],
+		})
+	}
+	return commits, nil
+}
+
+// The best common ancestor of two revs.
+func (client *Client) MergeBase(ctx context.Context, a string, b string) (string, error) {
+	stdOut, err := client.run(ctx, "merge-base", a, b)
+	if err != nil { return "", err }
+	return strings.TrimSpace(string(stdOut)), nil
+}
+
+func isBadRevError(stderr string) bool {
+	return strings.Contains(stderr, "unknown revision") ||
+		strings.Contains(stderr, "bad revision") ||
+		strings.Contains(stderr, "bad object")
+}
+
+type Blob struct {
+	Name string
+	Missing bool
+	// The size of the blob in bytes.
+	Size int64
+	// Left empty by CatFileSizes.
+	Content []byte
+}
+
+var catFileParseError = fmt.Errorf("An error was encountered while parsing git cat-file output")
+
+// Reads the contents of each named object in a single git invocation. Names are anything that
+// "git cat-file" understands, such as ":path/in/index" or "rev:path/in/rev". Objects which do not
+// exist (or names which cannot be passed to git) are returned with Missing set.
+func (client *Client) CatFileBatch(ctx context.Context, objectNames []string) ([]Blob, error) {
+	return client.catFile(ctx, objectNames, true)
+}
+
+// Reads the size of each named object, like "git cat-file -s" but in a single git invocation, and
+// without reading any content. Names are as for CatFileBatch.
+func (client *Client) CatFileSizes(ctx context.Context, objectNames []string) ([]Blob, error) {
+	return client.catFile(ctx, objectNames, false)
+}
+
+func (client *Client) catFile(
+	ctx context.Context,
+	objectNames []string,
+	withContent bool,
+) ([]Blob, error) {
+	blobs := make([]Blob, len(objectNames))
+	var input strings.Builder
+	requested := make([]int, 0, len(objectNames))
+	for i, name := range objectNames {
+		blobs[i] = Blob{Name: name, Missing: true}
+		// batch input is newline-delimited, so there's no way to ask for these
+		if strings.ContainsAny(name, "\n\r") { continue }
+		requested = append(requested, i)
+		_, _ = input.WriteString(name)
+		_, _ = input.WriteString("\n")
+	}
+	if len(requested) == 0 { return blobs, nil }
+
+	mode := "--batch-check"
+	if withContent { mode = "--batch" }
+	stdOut, err := client.runner.Run(Invocation{
+		Ctx: ctx,
+		Args: []string{"cat-file", mode},
+		Stdin: strings.NewReader(input.String()),
+		Env: commandEnv(os.Environ()),
+		Dir: client.dir,
+	})
+	if err != nil { return nil, err }
+
+	output := bufio.NewReader(bytes.NewReader(stdOut))
+	for _, i := range requested {
+		header, err := output.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%w: missing output for \"%s\"", catFileParseError, blobs[i].Name)
+		}
+
+		// format: "<name> missing" or "<object id> <type> <size>"
+		fields := strings.Fields(header)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%w: empty header for \"%s\"", catFileParseError, blobs[i].Name)
+		}
+		lastField := fields[len(fields)-1]
+		if lastField == "missing" || lastField == "ambiguous" { continue }
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%w: malformed header \"%s\"", catFileParseError, header)
+		}
+
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed size in header \"%s\"", catFileParseError, header)
+		}
+		var content []byte
+		if withContent {
+			// content is followed by a single newline which is not part of the object
+			content = make([]byte, size + 1)
+			_, err = io.ReadFull(output, content)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"%w: truncated content for \"%s\"",
+					catFileParseError, blobs[i].Name,
+				)
+			}
+			content = content[:size]
+		}
+
+		if fields[1] != "blob" { continue }
+		blobs[i].Missing = false
+		blobs[i].Size = int64(size)
+		blobs[i].Content = content
+	}
+
+	return blobs, nil
+}
+
+var checkAttrParseError = fmt.Errorf("An error was encountered while parsing git check-attr output")
+
+// Looks up git attributes for each path, as given by the .gitattributes files in the index (so
+// that staged changes to them count). Values are as git reports them: "set", "unset",
+// "unspecified", or the attribute's value. Results are keyed by path, then by attribute.
+func (client *Client) CheckAttr(
+	ctx context.Context,
+	attributes []string,
+	paths []string,
+) (map[string]map[string]string, error) {
+	result := make(map[string]map[string]string, len(paths))
+	if len(paths) == 0 { return result, nil }
+
+	var input strings.Builder
+	for _, path := range paths {
+		_, _ = input.WriteString(path)
+		_, _ = input.WriteString("\x00")
+	}
+	stdOut, err := client.runner.Run(Invocation{
+		Ctx: ctx,
+		Args: append([]string{"check-attr", "-z", "--stdin", "--cached"}, attributes...),
+		Stdin: strings.NewReader(input.String()),
+		Env: commandEnv(os.Environ()),
+		Dir: client.dir,
+	})
+	if err != nil { return nil, err }
+
+	// format (with -z): "<path>\0<attribute>\0<value>\0" for each path and attribute
+	fields := strings.Split(string(stdOut), "\x00")
+	fields = fields[:len(fields)-1]
+	if len(fields) % 3 != 0 {
+		return nil, fmt.Errorf("%w: incomplete entry", checkAttrParseError)
+	}
+	for i := 0; i < len(fields); i += 3 {
+		path, attribute, value := fields[i], fields[i+1], fields[i+2]
+		if result[path] == nil { result[path] = make(map[string]string, len(attributes)) }
+		result[path][attribute] = value
+	}
+	return result, nil
+}
+
+type ConfigEntry struct {
+	Origin string
+	Key string
+	Value string
+}
+
+// Reads every entry from a file in git-config syntax.
+func (client *Client) ConfigFileEntries(ctx context.Context, path string) ([]ConfigEntry, error) {
+	stdOut, err := client.run(
+		ctx,
+		"config", "--null", "--show-origin", "--file", path, "--list",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read config file \"%s\": %w", path, err)
+	}
+
+	return parseConfigEntries(stdOut)
+}
+
+// Reads every entry from git's own configuration (system, global, and repository) whose key
+// matches the provided regex.
+func (client *Client) ConfigEntries(ctx context.Context, keyRegex string) ([]ConfigEntry, error) {
+	stdOut, err := client.run(ctx, "config", "--null", "--show-origin", "--get-regexp", keyRegex)
+	cmdErr := &CommandError{}
+	if errors.As(err, &cmdErr) && cmdErr.ExitCode == 1 {
+		return []ConfigEntry{}, nil // no keys matched
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseConfigEntries(stdOut)
+}
+
+var configParseError = fmt.Errorf("An error was encountered while parsing git config output")
+
+// format (with --null and --show-origin): "<origin>\0<key>\n<value>\0" for each entry, or
+// "<origin>\0<key>\0" for keys which are present without a value. Like git, a key without a value
+// is treated as a boolean true.
+func parseConfigEntries(output []byte) ([]ConfigEntry, error) {
+	fields := strings.Split(string(output), "\x00")
+	// output is terminated by a NUL, so the final field is always empty
+	fields = fields[:len(fields)-1]
+	if len(fields) % 2 != 0 {
+		return nil, fmt.Errorf("%w: origin without a matching entry", configParseError)
+	}
+
+	entries := make([]ConfigEntry, 0, len(fields) / 2)
+	for i := 0; i < len(fields); i += 2 {
+		key, value, hasValue := strings.Cut(fields[i+1], "\n")
+		if !hasValue { value = "true" }
+		entries = append(entries, ConfigEntry{
+			Origin: fields[i],
+			Key: key,
+			Value: value,
+		})
+	}
+	return entries, nil
 }
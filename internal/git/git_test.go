@@ -0,0 +1,243 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecRunnerTimesOut(t *testing.T) {
+	if !ExecExists() { t.Skip("git is not installed") }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+	defer cancel()
+
+	// git waits for input which never comes
+	stdin, stdinWriter, err := os.Pipe()
+	assert.NoError(t, err)
+	defer stdin.Close()
+	defer stdinWriter.Close()
+
+	start := time.Now()
+	_, err = ExecRunner{}.Run(Invocation{
+		Ctx: ctx,
+		Args: []string{"hash-object", "--stdin"},
+		Stdin: stdin,
+		Dir: t.TempDir(),
+	})
+	assert.Less(t, time.Since(start), 5 * time.Second)
+
+	cmdErr := &CommandError{}
+	if assert.True(t, errors.As(err, &cmdErr)) {
+		assert.Equal(t, []string{"hash-object", "--stdin"}, cmdErr.Args)
+	}
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "Command \"git hash-object --stdin\" timed out")
+}
+
+func TestCommandErrorMessage(t *testing.T) {
+	err := &CommandError{
+		Args: []string{"diff", "nope"},
+		ExitCode: 128,
+		Stderr: "fatal: bad revision 'nope'\n",
+		Err: errors.New("exit status 128"),
+	}
+	assert.Equal(
+		t,
+		"Command \"git diff nope\" failed: exit status 128\nfatal: bad revision 'nope'",
+		err.Error(),
+	)
+
+	canceled := &CommandError{Args: []string{"status"}, ExitCode: -1, Err: context.Canceled}
+	assert.Equal(t, "Command \"git status\" was canceled", canceled.Error())
+}
+
+func TestCommandEnv(t *testing.T) {
+	env := commandEnv([]string{"HOME=/home/someone", "GIT_INDEX_FILE=/repo/.git/index.lock"})
+	assert.Equal(
+		t,
+		[]string{
+			"HOME=/home/someone",
+			"GIT_INDEX_FILE=/repo/.git/index.lock",
+			"LC_ALL=C",
+			"GIT_PAGER=cat",
+			"GIT_TERMINAL_PROMPT=0",
+			"GIT_CONFIG_COUNT=2",
+			"GIT_CONFIG_KEY_0=color.ui",
+			"GIT_CONFIG_VALUE_0=never",
+			"GIT_CONFIG_KEY_1=diff.suppressBlankEmpty",
+			"GIT_CONFIG_VALUE_1=false",
+		},
+		env,
+	)
+
+	// config already passed in the environment is kept
+	env = commandEnv([]string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=core.quotePath",
+		"GIT_CONFIG_VALUE_0=false",
+	})
+	assert.Subset(
+		t,
+		env,
+		[]string{
+			"GIT_CONFIG_KEY_0=core.quotePath",
+			"GIT_CONFIG_COUNT=3",
+			"GIT_CONFIG_KEY_1=color.ui",
+			"GIT_CONFIG_VALUE_1=never",
+			"GIT_CONFIG_KEY_2=diff.suppressBlankEmpty",
+			"GIT_CONFIG_VALUE_2=false",
+		},
+	)
+}
+
+func TestParseRevList(t *testing.T) {
+	commits, err := parseRevList(
+		"commit 2222\n2222\x001111\x00second: with a colon\n" +
+			"commit 1111\n1111\x00\x00root commit\n",
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]Commit{
+			{ID: "2222", Subject: "second: with a colon", Parents: []string{"1111"}},
+			{ID: "1111", Subject: "root commit", Parents: []string{}},
+		},
+		commits,
+	)
+
+	_, err = parseRevList("commit 1111\n1111 root commit\n")
+	assert.ErrorIs(t, err, revListParseError)
+}
+
+// A throwaway repository, for testing the commands which read from one. This can't use gittest,
+// which depends on this package.
+func newTestRepo(t *testing.T) (*Client, func(args ...string)) {
+	if !ExecExists() { t.Skip("git is not installed") }
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	dir := t.TempDir()
+	gitIn := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil { t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out) }
+	}
+	gitIn("init", "--quiet", "--initial-branch=main")
+	gitIn("config", "user.name", "Test User")
+	gitIn("config", "user.email", "test@example.com")
+	gitIn("config", "commit.gpgSign", "false")
+	return NewClient(ExecRunner{}, dir), gitIn
+}
+
+func writeTestFile(t *testing.T, client *Client, path string, content string) {
+	err := os.WriteFile(filepath.Join(client.dir, path), []byte(content), 0644)
+	assert.NoError(t, err)
+}
+
+func TestDiffIsOfTheIndex(t *testing.T) {
+	client, gitIn := newTestRepo(t)
+	writeTestFile(t, client, "f.txt", "one\n")
+	gitIn("add", "f.txt")
+	gitIn("commit", "--quiet", "--message", "first")
+
+	writeTestFile(t, client, "f.txt", "one\nstaged\n")
+	gitIn("add", "f.txt")
+	writeTestFile(t, client, "f.txt", "one\nstaged\nunstaged\n")
+
+	ctx := context.Background()
+	for _, rev := range []string{"", "HEAD", "main"} {
+		diff, err := client.Diff(ctx, rev)
+		assert.NoError(t, err)
+		assert.Contains(t, diff, "+staged", rev)
+		assert.NotContains(t, diff, "+unstaged", rev)
+	}
+
+	_, err := client.Diff(ctx, "nope")
+	assert.ErrorIs(t, err, ErrBadRev)
+}
+
+func TestCatFile(t *testing.T) {
+	client, gitIn := newTestRepo(t)
+	writeTestFile(t, client, "f.txt", "committed\n")
+	gitIn("add", "f.txt")
+	gitIn("commit", "--quiet", "--message", "first")
+	writeTestFile(t, client, "f.txt", "staged\n")
+	gitIn("add", "f.txt")
+	writeTestFile(t, client, "f.txt", "on disk only\n")
+
+	names := []string{":f.txt", "HEAD:f.txt", ":missing.txt", "HEAD", "bad\nname"}
+	ctx := context.Background()
+	blobs, err := client.CatFileBatch(ctx, names)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]Blob{
+			{Name: ":f.txt", Size: 7, Content: []byte("staged\n")},
+			{Name: "HEAD:f.txt", Size: 10, Content: []byte("committed\n")},
+			// missing, not a blob, and not something which can be asked for
+			{Name: ":missing.txt", Missing: true},
+			{Name: "HEAD", Missing: true},
+			{Name: "bad\nname", Missing: true},
+		},
+		blobs,
+	)
+
+	sizes, err := client.CatFileSizes(ctx, names)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]Blob{
+			{Name: ":f.txt", Size: 7},
+			{Name: "HEAD:f.txt", Size: 10},
+			{Name: ":missing.txt", Missing: true},
+			{Name: "HEAD", Missing: true},
+			{Name: "bad\nname", Missing: true},
+		},
+		sizes,
+	)
+}
+
+func TestValidRev(t *testing.T) {
+	client, gitIn := newTestRepo(t)
+	writeTestFile(t, client, "f.txt", "one\n")
+	gitIn("add", "f.txt")
+	gitIn("commit", "--quiet", "--message", "first")
+
+	ctx := context.Background()
+	valid, err := client.ValidRev(ctx, "HEAD")
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	valid, err = client.ValidRev(ctx, "nope")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+
+	rev, err := client.FirstValidRev(ctx, []string{"nope", "main"})
+	assert.NoError(t, err)
+	assert.Equal(t, "main", rev)
+	_, err = client.FirstValidRev(ctx, []string{"nope"})
+	assert.ErrorIs(t, err, ErrBadRev)
+
+	// git not finishing isn't the same as the rev not being valid
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = client.ValidRev(canceled, "HEAD")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = client.FirstValidRev(canceled, []string{"nope", "main"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrBadRev)
+
+	_, err = NewClient(ExecRunner{}, t.TempDir()).ValidRev(ctx, "HEAD")
+	assert.ErrorIs(t, err, ErrNotARepo)
+}
@@ -0,0 +1,142 @@
+// Test helpers for code which runs git.
+package gittest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/git"
+)
+
+// A scripted stand-in for git. Each command is answered with a canned response, chosen by the
+// command's exact arguments. Commands without a response fail, as if git didn't understand them.
+type FakeRunner struct {
+	responses map[string]Response
+	// Every invocation made, in order.
+	Invocations []git.Invocation
+}
+
+type Response struct {
+	Stdout string
+	Stderr string
+	// Anything other than 0 makes the command fail.
+	ExitCode int
+	// If set, called to compute the response instead, for commands which read standard input.
+	Respond func(invocation git.Invocation) Response
+}
+
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{responses: make(map[string]Response)}
+}
+
+// Answer the command with the given arguments (not including "git") with a response. Returns the
+// runner, so calls can be chained.
+func (fake *FakeRunner) On(response Response, args ...string) *FakeRunner {
+	fake.responses[argsKey(args)] = response
+	return fake
+}
+
+func (fake *FakeRunner) Run(invocation git.Invocation) ([]byte, error) {
+	fake.Invocations = append(fake.Invocations, invocation)
+	if invocation.Ctx != nil && invocation.Ctx.Err() != nil {
+		return nil, &git.CommandError{Args: invocation.Args, ExitCode: -1, Err: invocation.Ctx.Err()}
+	}
+
+	response, present := fake.responses[argsKey(invocation.Args)]
+	if !present {
+		response = Response{
+			Stderr: fmt.Sprintf("gittest: no response for \"git %s\"", argsKey(invocation.Args)),
+			ExitCode: 129,
+		}
+	}
+	if response.Respond != nil { response = response.Respond(invocation) }
+
+	if response.ExitCode != 0 {
+		return nil, &git.CommandError{
+			Args: invocation.Args,
+			ExitCode: response.ExitCode,
+			Stderr: response.Stderr,
+			Err: fmt.Errorf("exit status %d", response.ExitCode),
+		}
+	}
+	return []byte(response.Stdout), nil
+}
+
+// The arguments of every invocation made, each joined with spaces.
+func (fake *FakeRunner) Commands() []string {
+	commands := make([]string, len(fake.Invocations))
+	for i, invocation := range fake.Invocations {
+		commands[i] = argsKey(invocation.Args)
+	}
+	return commands
+}
+
+func argsKey(args []string) string {
+	return strings.Join(args, " ")
+}
+
+// A response for "git cat-file --batch" (or "--batch-check") which knows about the given objects,
+// keyed by object name (such as ":path/in/index"). Any other object is reported missing.
+func CatFileResponse(objects map[string]string) Response {
+	return Response{
+		Respond: func(invocation git.Invocation) Response {
+			withContent := !slices.Contains(invocation.Args, "--batch-check")
+			var stdout strings.Builder
+			input := bufio.NewScanner(invocation.Stdin)
+			for input.Scan() {
+				name := input.Text()
+				content, present := objects[name]
+				if !present {
+					fmt.Fprintf(&stdout, "%s missing\n", name)
+					continue
+				}
+				fmt.Fprintf(&stdout, "%s blob %d\n", blobID(content), len(content))
+				if withContent { fmt.Fprintf(&stdout, "%s\n", content) }
+			}
+			return Response{Stdout: stdout.String()}
+		},
+	}
+}
+
+// The object ID git would give a blob with this content.
+func blobID(content string) string {
+	hash := sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(content), content)))
+	return hex.EncodeToString(hash[:])
+}
+
+// A response for "git check-attr -z --stdin" which gives each path the attributes it's listed with
+// here, keyed by path and then attribute. Any other attribute is reported unspecified.
+func CheckAttrResponse(attributes map[string]map[string]string) Response {
+	return Response{
+		Respond: func(invocation git.Invocation) Response {
+			names := make([]string, 0)
+			for _, arg := range invocation.Args[1:] {
+				if !strings.HasPrefix(arg, "-") { names = append(names, arg) }
+			}
+
+			var stdout strings.Builder
+			input := bufio.NewScanner(invocation.Stdin)
+			input.Split(scanNulTerminated)
+			for input.Scan() {
+				path := input.Text()
+				for _, name := range names {
+					value, present := attributes[path][name]
+					if !present { value = "unspecified" }
+					fmt.Fprintf(&stdout, "%s\x00%s\x00%s\x00", path, name, value)
+				}
+			}
+			return Response{Stdout: stdout.String()}
+		},
+	}
+}
+
+func scanNulTerminated(data []byte, atEOF bool) (int, []byte, error) {
+	if end := bytes.IndexByte(data, 0); end >= 0 { return end + 1, data[:end], nil }
+	if atEOF && len(data) > 0 { return len(data), data, nil }
+	return 0, nil, nil
+}
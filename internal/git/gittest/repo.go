@@ -0,0 +1,139 @@
+package gittest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lorentzforces/check-changes/internal/git"
+)
+
+// A throwaway git repository for a test, with a bare repository as its "origin" remote. Every
+// method fails the test immediately if git does, and most return the repository so that calls can
+// be chained.
+type Repo struct {
+	t testing.TB
+	// The working tree of the repository.
+	Dir string
+	// The bare repository which is the "origin" remote.
+	OriginDir string
+}
+
+// Creates a repository on a "main" branch, with no commits. Also isolates the test from the
+// user's configuration, as IsolateConfig does.
+func NewRepo(t testing.TB) *Repo {
+	t.Helper()
+	if !git.ExecExists() { t.Skip("git is not installed") }
+	IsolateConfig(t)
+
+	repo := &Repo{t: t, Dir: t.TempDir(), OriginDir: t.TempDir()}
+	repo.runIn(repo.OriginDir, "init", "--quiet", "--bare", "--initial-branch=main")
+	repo.Git("init", "--quiet", "--initial-branch=main")
+	repo.Git("config", "user.name", "Test User")
+	repo.Git("config", "user.email", "test@example.com")
+	repo.Git("config", "commit.gpgSign", "false")
+	repo.Git("remote", "add", "origin", repo.OriginDir)
+	return repo
+}
+
+// Points HOME and git's global config at empty places for the rest of the test, so that the user's
+// own configuration doesn't affect anything.
+func IsolateConfig(t testing.TB) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+}
+
+// Runs git in the repository, and returns its standard output.
+func (repo *Repo) Git(args ...string) string {
+	repo.t.Helper()
+	return repo.runIn(repo.Dir, args...)
+}
+
+func (repo *Repo) runIn(dir string, args ...string) string {
+	repo.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		repo.t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// A client which runs git in the repository.
+func (repo *Repo) Client() *git.Client {
+	return git.NewClient(git.ExecRunner{}, repo.Dir)
+}
+
+// Writes a file in the working tree (creating any directories it needs), without staging it.
+func (repo *Repo) WriteFile(path string, content string) *Repo {
+	repo.t.Helper()
+	fullPath := filepath.Join(repo.Dir, path)
+	err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+	if err != nil { repo.t.Fatal(err) }
+	err = os.WriteFile(fullPath, []byte(content), 0644)
+	if err != nil { repo.t.Fatal(err) }
+	return repo
+}
+
+// Stages the given paths, or every change if no paths are given.
+func (repo *Repo) Stage(paths ...string) *Repo {
+	repo.t.Helper()
+	if len(paths) == 0 {
+		repo.Git("add", "--all")
+	} else {
+		repo.Git(append([]string{"add", "--"}, paths...)...)
+	}
+	return repo
+}
+
+// Writes a file and stages it.
+func (repo *Repo) StageFile(path string, content string) *Repo {
+	repo.t.Helper()
+	return repo.WriteFile(path, content).Stage(path)
+}
+
+// Commits whatever is staged.
+func (repo *Repo) Commit(message string) *Repo {
+	repo.t.Helper()
+	repo.Git("commit", "--quiet", "--allow-empty", "--message", message)
+	return repo
+}
+
+// Creates a branch at the current commit and switches to it.
+func (repo *Repo) Branch(name string) *Repo {
+	repo.t.Helper()
+	repo.Git("checkout", "--quiet", "-b", name)
+	return repo
+}
+
+func (repo *Repo) Checkout(rev string) *Repo {
+	repo.t.Helper()
+	repo.Git("checkout", "--quiet", rev)
+	return repo
+}
+
+// Stashes every change, including untracked files.
+func (repo *Repo) Stash(message string) *Repo {
+	repo.t.Helper()
+	repo.Git("stash", "push", "--quiet", "--include-untracked", "--message", message)
+	return repo
+}
+
+// Pushes the current branch to origin, and sets it as the upstream.
+func (repo *Repo) Push() *Repo {
+	repo.t.Helper()
+	repo.Git("push", "--quiet", "--set-upstream", "origin", "HEAD")
+	return repo
+}
+
+// The full object ID of a rev.
+func (repo *Repo) RevParse(rev string) string {
+	repo.t.Helper()
+	return strings.TrimSpace(repo.Git("rev-parse", rev))
+}
@@ -0,0 +1,98 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// A single run of git.
+type Invocation struct {
+	Ctx context.Context
+	// Arguments to git, not including "git" itself.
+	Args []string
+	// Standard input for the command, if any.
+	Stdin io.Reader
+	// The complete environment for the command. Nil means the command inherits this process's
+	// environment; an empty slice means the command gets no environment at all.
+	Env []string
+	// The directory to run in. Empty means this process's working directory.
+	Dir string
+}
+
+// Runs git commands. Implementations return standard output, and report failure with a
+// CommandError.
+type Runner interface {
+	Run(invocation Invocation) ([]byte, error)
+}
+
+// Runs the real git executable.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(invocation Invocation) ([]byte, error) {
+	ctx := invocation.Ctx
+	if ctx == nil { ctx = context.Background() }
+
+	cmd := exec.CommandContext(ctx, "git", invocation.Args...)
+	cmd.Stdin = invocation.Stdin
+	cmd.Env = invocation.Env
+	cmd.Dir = invocation.Dir
+	// once git is killed, don't wait forever on anything it left holding its output open
+	cmd.WaitDelay = time.Second
+	var stdErr bytes.Buffer
+	cmd.Stderr = &stdErr
+
+	stdOut, err := cmd.Output()
+	if err == nil { return stdOut, nil }
+
+	cmdErr := &CommandError{Args: invocation.Args, ExitCode: -1, Stderr: stdErr.String(), Err: err}
+	if ctx.Err() != nil {
+		// whatever killing git caused is beside the point
+		cmdErr.Err = ctx.Err()
+		return nil, cmdErr
+	}
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) { cmdErr.ExitCode = exitErr.ExitCode() }
+	return nil, cmdErr
+}
+
+// A git command which could not be run, or exited unsuccessfully.
+type CommandError struct {
+	Args []string
+	// The exit code of the command, or -1 if it never ran to completion.
+	ExitCode int
+	// Whatever the command printed to standard error, if anything.
+	Stderr string
+	Err error
+}
+
+func (err *CommandError) Error() string {
+	command := strings.Join(err.Args, " ")
+	if errors.Is(err.Err, context.DeadlineExceeded) {
+		return fmt.Sprintf("Command \"git %s\" timed out", command)
+	}
+	if errors.Is(err.Err, context.Canceled) {
+		return fmt.Sprintf("Command \"git %s\" was canceled", command)
+	}
+
+	message := fmt.Sprintf("Command \"git %s\" failed: %s", command, err.Err)
+	stderr := strings.TrimSpace(err.Stderr)
+	if len(stderr) > 0 { message += "\n" + stderr }
+	return message
+}
+
+func (err *CommandError) Unwrap() error {
+	return err.Err
+}
+
+// The standard error of a failed command, or empty if the error isn't from a command.
+func stderrOf(err error) string {
+	cmdErr := &CommandError{}
+	if !errors.As(err, &cmdErr) { return "" }
+	return cmdErr.Stderr
+}
@@ -0,0 +1,129 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/lorentzforces/check-changes/internal/checking"
+)
+
+// The version of the JSON output schema. This is incremented whenever a field is removed or its
+// meaning changes; new fields may be added without changing the version.
+const jsonSchemaVersion = 1
+
+type jsonReport struct {
+	Version int `json:"version"`
+	Findings []jsonFinding `json:"findings"`
+	Suppressed []jsonFinding `json:"suppressed"`
+	Summary jsonSummary `json:"summary"`
+}
+
+type jsonFinding struct {
+	Check string `json:"check"`
+	Severity checking.Severity `json:"severity"`
+	File string `json:"file,omitempty"`
+	Line uint `json:"line,omitempty"`
+	Column uint `json:"column,omitempty"`
+	Message string `json:"message"`
+	Context string `json:"context,omitempty"`
+	Details checking.CheckFlag `json:"details"`
+}
+
+type jsonSummary struct {
+	Errors int `json:"errors"`
+	Warnings int `json:"warnings"`
+	Notes int `json:"notes"`
+	Total int `json:"total"`
+	Suppressed int `json:"suppressed"`
+	Baselined int `json:"baselined"`
+}
+
+func WriteJSON(out io.Writer, report checking.CheckReport) error {
+	result := jsonReport{
+		Version: jsonSchemaVersion,
+		Findings: toJSONFindings(report.Findings),
+		Suppressed: toJSONFindings(report.Suppressed),
+		Summary: summarize(report),
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+type jsonCommitsReport struct {
+	Version int `json:"version"`
+	Commits []jsonCommit `json:"commits"`
+	Unattributed jsonUnattributed `json:"unattributed"`
+}
+
+type jsonCommit struct {
+	ID string `json:"id"`
+	Subject string `json:"subject"`
+	Findings []jsonFinding `json:"findings"`
+	// Findings which this commit introduced, but which a later commit fixed.
+	Fixed []jsonFinding `json:"fixed"`
+	Suppressed []jsonFinding `json:"suppressed"`
+	Summary jsonSummary `json:"summary"`
+}
+
+// Findings present by HEAD which no one commit introduced, such as from resolving a merge conflict.
+type jsonUnattributed struct {
+	Findings []jsonFinding `json:"findings"`
+	Summary jsonSummary `json:"summary"`
+}
+
+// Every commit is included, even those without findings, so that it's clear which were checked.
+func WriteCommitsJSON(out io.Writer, rangeReport checking.RangeReport) error {
+	result := jsonCommitsReport{
+		Version: jsonSchemaVersion,
+		Commits: make([]jsonCommit, 0, len(rangeReport.Commits)),
+		Unattributed: jsonUnattributed{
+			Findings: toJSONFindings(rangeReport.Unattributed.Findings),
+			Summary: summarize(rangeReport.Unattributed),
+		},
+	}
+	for _, report := range rangeReport.Commits {
+		result.Commits = append(result.Commits, jsonCommit{
+			ID: report.Commit.ID,
+			Subject: report.Commit.Subject,
+			Findings: toJSONFindings(report.Findings),
+			Fixed: toJSONFindings(report.Fixed),
+			Suppressed: toJSONFindings(report.Suppressed),
+			Summary: summarize(report.CheckReport),
+		})
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+func toJSONFindings(findings []checking.Finding) []jsonFinding {
+	result := make([]jsonFinding, 0, len(findings))
+	for _, finding := range findings {
+		location := finding.Flag.Location()
+		result = append(result, jsonFinding{
+			Check: finding.Check,
+			Severity: finding.Severity,
+			File: location.File,
+			Line: location.Line,
+			Column: location.Column,
+			Message: finding.Flag.Message(),
+			Context: finding.Flag.ContextMsg(),
+			Details: finding.Flag,
+		})
+	}
+	return result
+}
+
+func summarize(report checking.CheckReport) jsonSummary {
+	return jsonSummary{
+		Errors: len(report.WithSeverity(checking.SeverityError)),
+		Warnings: len(report.WithSeverity(checking.SeverityWarning)),
+		Notes: len(report.WithSeverity(checking.SeverityNote)),
+		Total: len(report.Findings),
+		Suppressed: len(report.Suppressed),
+		Baselined: len(report.Baselined),
+	}
+}
@@ -0,0 +1,32 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Format string
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+	FormatSARIF Format = "sarif"
+	FormatJUnit Format = "junit"
+	FormatCheckstyle Format = "checkstyle"
+)
+
+var formats = []Format{FormatText, FormatJSON, FormatSARIF, FormatJUnit, FormatCheckstyle}
+
+func ParseFormat(raw string) (Format, error) {
+	for _, format := range formats {
+		if strings.ToLower(raw) == string(format) { return format, nil }
+	}
+
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = string(format)
+	}
+	return FormatText, fmt.Errorf(
+		"Invalid output format \"%s\": must be one of %s",
+		raw, strings.Join(names, ", "),
+	)
+}
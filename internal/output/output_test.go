@@ -0,0 +1,403 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/lorentzforces/check-changes/internal/checking"
+	"github.com/lorentzforces/check-changes/internal/git"
+	"github.com/stretchr/testify/assert"
+)
+
+var testReport = checking.CheckReport{
+	Findings: []checking.Finding{
+		{
+			Check: "keyword",
+			Severity: checking.SeverityError,
+			Flag: checking.KeywordPresenceFlag{
+				FileName: "src/main.go",
+				LineNumber: 12,
+				Column: 5,
+				Keyword: "NOCHECKIN",
+				MatchedText: "NOCHECKIN",
+				LineContent: "\t// NOCHECKIN",
+			},
+		},
+		{
+			Check: "indent",
+			Severity: checking.SeverityError,
+			Flag: checking.LineIndentFlag{
+				FileName: "src/main.go",
+				LineNumber: 14,
+				FileIndents: checking.IndentTab,
+				LineIndents: checking.IndentSpace,
+				LineContent: "    return nil",
+			},
+		},
+		{
+			Check: "keyword",
+			Severity: checking.SeverityNote,
+			Flag: checking.KeywordPresenceFlag{
+				FileName: "docs/read me.md",
+				LineNumber: 3,
+				Column: 1,
+				Keyword: "TODO",
+				MatchedText: "TODO",
+				LineContent: "TODO: write the docs",
+			},
+		},
+		{
+			Check: "stash",
+			Severity: checking.SeverityWarning,
+			Flag: checking.StashEntryFlag{
+				Number: 0,
+				FullLine: "stash@{0}: WIP on main: 12abc5 something",
+			},
+		},
+	},
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// A fixed set of checks, so that golden files don't change whenever a check is registered.
+var testChecks = []checking.Check{}
+
+func init() {
+	for _, check := range checking.RegisteredChecks() {
+		switch check.Name() {
+			case "stash", "indent", "keyword": testChecks = append(testChecks, check)
+		}
+	}
+}
+
+func assertGolden(t *testing.T, goldenFile string, actual []byte) {
+	if *updateGolden {
+		err := os.WriteFile(goldenFile, actual, 0644)
+		assert.Nil(t, err)
+		return
+	}
+
+	expected, err := os.ReadFile(goldenFile)
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), string(actual), "output does not match %s", goldenFile)
+}
+
+func TestJSONSchema(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteJSON(&buf, testReport)
+	assert.Nil(t, err)
+
+	var decoded map[string]any
+	err = json.Unmarshal(buf.Bytes(), &decoded)
+	assert.Nil(t, err)
+	if t.Failed() { t.FailNow() }
+
+	assert.Equal(t, float64(jsonSchemaVersion), decoded["version"])
+	assert.Equal(
+		t,
+		map[string]any{
+			"errors": 2.0, "warnings": 1.0, "notes": 1.0, "total": 4.0,
+			"suppressed": 0.0, "baselined": 0.0,
+		},
+		decoded["summary"],
+	)
+
+	findings := decoded["findings"].([]any)
+	assert.Len(t, findings, 4)
+	if t.Failed() { t.FailNow() }
+
+	keywordFinding := findings[0].(map[string]any)
+	assert.Equal(t, "keyword", keywordFinding["check"])
+	assert.Equal(t, "error", keywordFinding["severity"])
+	assert.Equal(t, "src/main.go", keywordFinding["file"])
+	assert.Equal(t, 12.0, keywordFinding["line"])
+	assert.Equal(t, 5.0, keywordFinding["column"])
+	assert.Equal(t, "line contains keyword \"NOCHECKIN\"", keywordFinding["message"])
+	assert.Equal(t, "// NOCHECKIN", keywordFinding["context"])
+	assert.Equal(t, "NOCHECKIN", keywordFinding["details"].(map[string]any)["keyword"])
+
+	indentDetails := findings[1].(map[string]any)["details"].(map[string]any)
+	assert.Equal(t, "IndentTab", indentDetails["fileIndents"])
+
+	stashFinding := findings[3].(map[string]any)
+	assert.NotContains(t, stashFinding, "file")
+	assert.NotContains(t, stashFinding, "line")
+	assert.Equal(t, "warning", stashFinding["severity"])
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("JSON")
+	assert.Nil(t, err)
+	assert.Equal(t, FormatJSON, format)
+
+	_, err = ParseFormat("yaml")
+	assert.NotNil(t, err)
+}
+
+func TestSARIFGolden(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteSARIF(&buf, testReport, testChecks)
+	assert.Nil(t, err)
+
+	assertGolden(t, "sarif-golden.json", buf.Bytes())
+}
+
+func TestJUnitGolden(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteJUnit(&buf, testReport, testChecks)
+	assert.Nil(t, err)
+
+	assertGolden(t, "junit-golden.xml", buf.Bytes())
+}
+
+func TestCheckstyleGolden(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCheckstyle(&buf, testReport)
+	assert.Nil(t, err)
+
+	assertGolden(t, "checkstyle-golden.xml", buf.Bytes())
+}
+
+func TestPlainTextGolden(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteText(&buf, testReport, TextOpts{})
+	assert.Nil(t, err)
+
+	assertGolden(t, "text-plain-golden.txt", buf.Bytes())
+}
+
+func TestPrettyTextGolden(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteText(&buf, testReport, TextOpts{Pretty: true})
+	assert.Nil(t, err)
+	assertGolden(t, "text-pretty-golden.txt", buf.Bytes())
+
+	buf.Reset()
+	err = WriteText(&buf, testReport, TextOpts{Pretty: true, Color: true})
+	assert.Nil(t, err)
+	assertGolden(t, "text-color-golden.txt", buf.Bytes())
+}
+
+func TestResolveTextOpts(t *testing.T) {
+	cases := []struct{
+		mode ColorMode
+		isTerminal bool
+		noColor string
+		expected TextOpts
+	} {
+		{ ColorAuto, false, "", TextOpts{} },
+		{ ColorAuto, true, "", TextOpts{Pretty: true, Color: true} },
+		{ ColorAuto, true, "1", TextOpts{Pretty: true} },
+		{ ColorNever, true, "", TextOpts{Pretty: true} },
+		{ ColorNever, false, "", TextOpts{} },
+		{ ColorAlways, false, "1", TextOpts{Pretty: true, Color: true} },
+	}
+
+	for _, testCase := range cases {
+		result := ResolveTextOpts(testCase.mode, testCase.isTerminal, testCase.noColor)
+		assert.Equal(
+			t, testCase.expected, result,
+			"mode %s, terminal %t, NO_COLOR \"%s\"",
+			testCase.mode, testCase.isTerminal, testCase.noColor,
+		)
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	order, err := ParseSortOrder("Severity")
+	assert.NoError(t, err)
+	assert.Equal(t, SortBySeverity, order)
+
+	_, err = ParseSortOrder("line")
+	assert.Error(t, err)
+}
+
+func checksAndLines(findings []checking.Finding) []string {
+	described := make([]string, len(findings))
+	for i, finding := range findings {
+		location := finding.Flag.Location()
+		described[i] = fmt.Sprintf("%s %s:%d", finding.Check, location.File, location.Line)
+	}
+	return described
+}
+
+func TestSortReport(t *testing.T) {
+	byFile := SortReport(testReport, SortByFile)
+	assert.Equal(
+		t,
+		[]string{
+			"stash :0",
+			"keyword docs/read me.md:3",
+			"keyword src/main.go:12",
+			"indent src/main.go:14",
+		},
+		checksAndLines(byFile.Findings),
+	)
+
+	bySeverity := SortReport(testReport, SortBySeverity)
+	assert.Equal(
+		t,
+		[]string{
+			"keyword src/main.go:12",
+			"indent src/main.go:14",
+			"stash :0",
+			"keyword docs/read me.md:3",
+		},
+		checksAndLines(bySeverity.Findings),
+	)
+
+	byCheck := SortReport(testReport, SortByCheck)
+	assert.Equal(
+		t,
+		[]string{
+			"indent src/main.go:14",
+			"keyword docs/read me.md:3",
+			"keyword src/main.go:12",
+			"stash :0",
+		},
+		checksAndLines(byCheck.Findings),
+	)
+
+	// the result doesn't depend on the order findings started in
+	reversed := testReport
+	reversed.Findings = slices.Clone(testReport.Findings)
+	slices.Reverse(reversed.Findings)
+	for _, order := range sortOrders {
+		assert.Equal(t, SortReport(testReport, order), SortReport(reversed, order), order)
+	}
+
+	// the original report is left alone
+	assert.Equal(t, "keyword src/main.go:12", checksAndLines(testReport.Findings)[0])
+}
+
+var testRangeReport = checking.RangeReport{
+	Commits: []checking.CommitReport{
+		{
+			Commit: git.Commit{ID: "0123456789abcdef", Subject: "add the main package"},
+			CheckReport: checking.CheckReport{Findings: testReport.Findings[1:2]},
+			Fixed: testReport.Findings[0:1],
+		},
+		{
+			Commit: git.Commit{ID: "fedcba9876543210", Subject: "nothing to see here"},
+		},
+	},
+	Unattributed: checking.CheckReport{Findings: testReport.Findings[2:3]},
+}
+
+func TestCommitsText(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCommitsText(&buf, testRangeReport, TextOpts{})
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"commit 0123456 add the main package\n"+
+			"POTENTIAL MAJOR ISSUES:\n"+
+			"  - src/main.go:14 | line has indentation (IndentSpace) inconsistent with the rest of the "+
+			"file (IndentTab)\n"+
+			"\n"+
+			"FIXED LATER IN THE RANGE (1):\n"+
+			"  - src/main.go:12 | line contains keyword \"NOCHECKIN\"\n"+
+			"    // NOCHECKIN\n"+
+			"\n"+
+			"not introduced by any single commit (such as by resolving a merge conflict)\n"+
+			"NOTES:\n"+
+			"  - docs/read me.md:3 | line contains keyword \"TODO\"\n"+
+			"    TODO: write the docs\n",
+		buf.String(),
+	)
+
+	buf.Reset()
+	clean := checking.RangeReport{Commits: testRangeReport.Commits[1:]}
+	err = WriteCommitsText(&buf, clean, TextOpts{Pretty: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "No issues found in 1 commit.\n", buf.String())
+}
+
+func TestCommitsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCommitsJSON(&buf, testRangeReport)
+	assert.NoError(t, err)
+
+	var decoded struct {
+		Version int `json:"version"`
+		Commits []struct {
+			ID string `json:"id"`
+			Subject string `json:"subject"`
+			Findings []map[string]any `json:"findings"`
+			Fixed []map[string]any `json:"fixed"`
+			Summary map[string]int `json:"summary"`
+		} `json:"commits"`
+		Unattributed struct {
+			Findings []map[string]any `json:"findings"`
+			Summary map[string]int `json:"summary"`
+		} `json:"unattributed"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &decoded)
+	assert.NoError(t, err)
+
+	assert.Equal(t, jsonSchemaVersion, decoded.Version)
+	assert.Len(t, decoded.Commits, 2)
+	assert.Equal(t, "0123456789abcdef", decoded.Commits[0].ID)
+	assert.Equal(t, "add the main package", decoded.Commits[0].Subject)
+	assert.Len(t, decoded.Commits[0].Findings, 1)
+	assert.Equal(t, "NOCHECKIN", decoded.Commits[0].Fixed[0]["details"].(map[string]any)["keyword"])
+	assert.Equal(t, 1, decoded.Commits[0].Summary["errors"])
+	// commits without findings still have (empty) lists
+	assert.NotNil(t, decoded.Commits[1].Findings)
+	assert.NotNil(t, decoded.Commits[1].Fixed)
+	assert.Equal(t, "docs/read me.md", decoded.Unattributed.Findings[0]["file"])
+	assert.Equal(t, 1, decoded.Unattributed.Summary["notes"])
+}
+
+func TestFileLevelFindingText(t *testing.T) {
+	report := checking.CheckReport{
+		Findings: []checking.Finding{{
+			Check: "file-guard",
+			Severity: checking.SeverityError,
+			Flag: checking.LargeFileFlag{
+				FileName: "assets/video.mp4",
+				Size: 3 * 1024 * 1024,
+				Limit: 1024 * 1024,
+			},
+		}},
+	}
+
+	var buf bytes.Buffer
+	err := WriteText(&buf, report, TextOpts{HideContext: true})
+	assert.Nil(t, err)
+	assert.Contains(
+		t,
+		buf.String(),
+		"  - assets/video.mp4 | file is 3.0 MiB, over the size limit of 1.0 MiB\n",
+	)
+
+	buf.Reset()
+	err = WriteJUnit(&buf, report, checking.RegisteredChecks())
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `name="assets/video.mp4"`)
+}
+
+func TestJUnitIncludesUnregisteredChecks(t *testing.T) {
+	report := checking.CheckReport{
+		Findings: []checking.Finding{{
+			Check: "unused-suppression",
+			Severity: checking.SeverityWarning,
+			Flag: checking.UnusedSuppressionFlag{
+				FileName: "src/main.go",
+				LineNumber: 3,
+				Directive: "check-changes:ignore keyword",
+			},
+		}},
+	}
+
+	var buf bytes.Buffer
+	err := WriteJUnit(&buf, report, testChecks)
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `<testsuite name="unused-suppression" tests="1" failures="1">`)
+	assert.Contains(t, buf.String(), `<testsuites name="check-changes" tests="4" failures="1">`)
+}
@@ -0,0 +1,180 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/checking"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+const sarifVersion = "2.1.0"
+const toolName = "check-changes"
+const toolURI = "https://github.com/lorentzforces/git-corpa"
+
+// Only the parts of the SARIF 2.1.0 object model which check-changes has any use for.
+
+type sarifLog struct {
+	Schema string `json:"$schema"`
+	Version string `json:"version"`
+	Runs []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool sarifTool `json:"tool"`
+	// columns are counted in characters rather than UTF-16 code units
+	ColumnKind string `json:"columnKind"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name string `json:"name"`
+	InformationURI string `json:"informationUri"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID string `json:"ruleId"`
+	RuleIndex *int `json:"ruleIndex,omitempty"`
+	Level string `json:"level"`
+	Message sarifMessage `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind string `json:"kind"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region *sarifRegion `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine uint `json:"startLine"`
+	StartColumn uint `json:"startColumn,omitempty"`
+}
+
+// Write the report as a SARIF log. Each of the provided checks becomes a rule, and each finding
+// becomes a result of the rule for the check which raised it.
+func WriteSARIF(out io.Writer, report checking.CheckReport, checks []checking.Check) error {
+	driver := sarifDriver{
+		Name: toolName,
+		InformationURI: toolURI,
+		Rules: make([]sarifRule, 0, len(checks)),
+	}
+	ruleIndexes := make(map[string]int, len(checks))
+	for i, check := range checks {
+		ruleIndexes[check.Name()] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID: check.Name(),
+			ShortDescription: sarifMessage{Text: check.Description()},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(check.DefaultSeverity())},
+		})
+	}
+
+	// suppressed findings are included, but marked as suppressed in the source, so that
+	// code-scanning tools can treat them the way they treat any other suppression
+	allFindings := append(slices.Clone(report.Findings), report.Suppressed...)
+	results := make([]sarifResult, 0, len(allFindings))
+	for i, finding := range allFindings {
+		result := sarifResult{
+			RuleID: finding.Check,
+			Level: sarifLevel(finding.Severity),
+			Message: sarifMessage{Text: sarifMessageText(finding.Flag)},
+		}
+		if index, ok := ruleIndexes[finding.Check]; ok {
+			result.RuleIndex = &index
+		}
+
+		location := finding.Flag.Location()
+		if len(location.File) > 0 {
+			physical := sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{
+					URI: pathToURI(location.File),
+					URIBaseID: "%SRCROOT%",
+				},
+			}
+			if location.Line > 0 {
+				physical.Region = &sarifRegion{
+					StartLine: location.Line,
+					StartColumn: location.Column,
+				}
+			}
+			result.Locations = []sarifLocation{{PhysicalLocation: physical}}
+		}
+		if i >= len(report.Findings) {
+			result.Suppressions = []sarifSuppression{{Kind: "inSource"}}
+		}
+
+		results = append(results, result)
+	}
+
+	log := sarifLog{
+		Schema: sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{Driver: driver},
+				ColumnKind: "unicodeCodePoints",
+				Results: results,
+			},
+		},
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func sarifLevel(severity checking.Severity) string {
+	// SARIF uses the same names for its levels
+	return severity.String()
+}
+
+func sarifMessageText(flag checking.CheckFlag) string {
+	context := flag.ContextMsg()
+	if len(context) == 0 { return flag.Message() }
+	return flag.Message() + ": " + context
+}
+
+// Repository paths use forward slashes, but each segment still needs escaping to be a valid URI
+// reference.
+func pathToURI(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
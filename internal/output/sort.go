@@ -0,0 +1,83 @@
+package output
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/checking"
+)
+
+type SortOrder string
+const (
+	// By file path, then position in the file, then check name. This is the order findings are
+	// reported in to begin with.
+	SortByFile SortOrder = "file"
+	// Most severe first, then as for SortByFile.
+	SortBySeverity SortOrder = "severity"
+	// By check name, then as for SortByFile.
+	SortByCheck SortOrder = "check"
+)
+
+var sortOrders = []SortOrder{SortByFile, SortBySeverity, SortByCheck}
+
+func ParseSortOrder(raw string) (SortOrder, error) {
+	for _, order := range sortOrders {
+		if strings.ToLower(raw) == string(order) { return order, nil }
+	}
+
+	names := make([]string, len(sortOrders))
+	for i, order := range sortOrders {
+		names[i] = string(order)
+	}
+	return SortByFile, fmt.Errorf(
+		"Invalid sort order \"%s\": must be one of %s",
+		raw, strings.Join(names, ", "),
+	)
+}
+
+// A copy of the report with each list of findings in the given order. Ties are always broken the
+// same way, so the result doesn't depend on the order findings were in to begin with.
+func SortReport(report checking.CheckReport, order SortOrder) checking.CheckReport {
+	return checking.CheckReport{
+		Findings: sortedFindings(report.Findings, order),
+		Suppressed: sortedFindings(report.Suppressed, order),
+		Baselined: sortedFindings(report.Baselined, order),
+	}
+}
+
+// A copy of the range report, with each commit's findings sorted as for SortReport. Commits stay
+// in the order given.
+func SortRangeReport(report checking.RangeReport, order SortOrder) checking.RangeReport {
+	sorted := checking.RangeReport{
+		Commits: make([]checking.CommitReport, len(report.Commits)),
+		Unattributed: SortReport(report.Unattributed, order),
+	}
+	for i, commit := range report.Commits {
+		sorted.Commits[i] = checking.CommitReport{
+			Commit: commit.Commit,
+			CheckReport: SortReport(commit.CheckReport, order),
+			Fixed: sortedFindings(commit.Fixed, order),
+		}
+	}
+	return sorted
+}
+
+func sortedFindings(findings []checking.Finding, order SortOrder) []checking.Finding {
+	compare := checking.CompareFindings
+	switch order {
+		case SortBySeverity:
+			compare = func(a, b checking.Finding) int {
+				return cmp.Or(cmp.Compare(b.Severity, a.Severity), checking.CompareFindings(a, b))
+			}
+		case SortByCheck:
+			compare = func(a, b checking.Finding) int {
+				return cmp.Or(cmp.Compare(a.Check, b.Check), checking.CompareFindings(a, b))
+			}
+	}
+
+	findings = slices.Clone(findings)
+	slices.SortStableFunc(findings, compare)
+	return findings
+}
@@ -0,0 +1,364 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lorentzforces/check-changes/internal/checking"
+)
+
+type TextOpts struct {
+	HideContext bool
+	ShowSuppressed bool
+	// Group findings by file and end with a summary, rather than the plain (script-friendly)
+	// layout grouped by severity.
+	Pretty bool
+	// Use ANSI escapes to colorize pretty output.
+	Color bool
+}
+
+type ColorMode string
+const (
+	ColorAuto ColorMode = "auto"
+	ColorAlways ColorMode = "always"
+	ColorNever ColorMode = "never"
+)
+
+func ParseColorMode(raw string) (ColorMode, error) {
+	switch mode := ColorMode(strings.ToLower(raw)); mode {
+		case ColorAuto, ColorAlways, ColorNever: return mode, nil
+	}
+	return ColorAuto, fmt.Errorf(
+		"Invalid color mode \"%s\": must be one of auto, always, never",
+		raw,
+	)
+}
+
+// Decide how text should be rendered. Pretty output is used for terminals (or when color is
+// forced), and is colorized unless color is turned off. As per https://no-color.org, a non-empty
+// NO_COLOR turns off color unless it is explicitly requested.
+func ResolveTextOpts(mode ColorMode, isTerminal bool, noColorEnv string) TextOpts {
+	opts := TextOpts{}
+	switch mode {
+		case ColorAlways:
+			opts.Pretty = true
+			opts.Color = true
+		case ColorNever:
+			opts.Pretty = isTerminal
+		default:
+			opts.Pretty = isTerminal
+			opts.Color = isTerminal && len(noColorEnv) == 0
+	}
+	return opts
+}
+
+func WriteText(out io.Writer, report checking.CheckReport, opts TextOpts) error {
+	var buf strings.Builder
+	if opts.Pretty {
+		writePrettyText(&buf, report, opts)
+	} else {
+		writePlainText(&buf, report, opts)
+	}
+	_, err := io.WriteString(out, buf.String())
+	return err
+}
+
+// Commits are shown by the first characters of their IDs, as in git's own short output.
+const shortCommitIDLength = 7
+
+// Each commit with anything to report gets a heading, followed by its findings as for WriteText,
+// and then the findings which a later commit fixed. Findings which no one commit introduced come
+// last, under a heading of their own.
+func WriteCommitsText(out io.Writer, rangeReport checking.RangeReport, opts TextOpts) error {
+	s := styler{enabled: opts.Pretty && opts.Color}
+	var buf strings.Builder
+	writeReport := func(report checking.CheckReport) {
+		if opts.Pretty {
+			writePrettyText(&buf, report, opts)
+		} else {
+			writePlainText(&buf, report, opts)
+		}
+	}
+
+	isFirst := true
+	for _, report := range rangeReport.Commits {
+		hasSuppressed := opts.ShowSuppressed && len(report.Suppressed) > 0
+		if len(report.Findings) == 0 && len(report.Fixed) == 0 && !hasSuppressed { continue }
+		if !isFirst { _, _ = buf.WriteString("\n") }
+		isFirst = false
+
+		id := report.Commit.ID
+		if len(id) > shortCommitIDLength { id = id[:shortCommitIDLength] }
+		_, _ = fmt.Fprintf(
+			&buf,
+			"%s %s\n",
+			s.style("commit "+id, ansiBold, ansiYellow),
+			s.style(report.Commit.Subject, ansiBold),
+		)
+
+		if len(report.Findings) > 0 || hasSuppressed { writeReport(report.CheckReport) }
+
+		if len(report.Fixed) > 0 {
+			if len(report.Findings) > 0 || hasSuppressed { _, _ = buf.WriteString("\n") }
+			heading := fmt.Sprintf("FIXED LATER IN THE RANGE (%d):", len(report.Fixed))
+			_, _ = fmt.Fprintf(&buf, "%s\n", s.style(heading, ansiBold, ansiDim))
+			for _, finding := range report.Fixed {
+				if opts.Pretty {
+					writePrettyFinding(&buf, s, finding, true, opts)
+				} else {
+					writePlainFinding(&buf, finding, opts)
+				}
+			}
+		}
+	}
+
+	if len(rangeReport.Unattributed.Findings) > 0 {
+		if !isFirst { _, _ = buf.WriteString("\n") }
+		isFirst = false
+		heading := "not introduced by any single commit (such as by resolving a merge conflict)"
+		_, _ = fmt.Fprintf(&buf, "%s\n", s.style(heading, ansiBold, ansiYellow))
+		writeReport(rangeReport.Unattributed)
+	}
+
+	if opts.Pretty && isFirst {
+		_, _ = fmt.Fprintf(
+			&buf,
+			"No issues found in %s.\n",
+			pluralize(len(rangeReport.Commits), "commit"),
+		)
+	}
+	_, err := io.WriteString(out, buf.String())
+	return err
+}
+
+// The plain layout is relied upon by scripts, so it must not change.
+func writePlainText(buf *strings.Builder, report checking.CheckReport, opts TextOpts) {
+	sections := []struct{
+		heading string
+		findings []checking.Finding
+	} {
+		{ "POTENTIAL MAJOR ISSUES:", report.WithSeverity(checking.SeverityError) },
+		{ "POTENTIAL ISSUES:", report.WithSeverity(checking.SeverityWarning) },
+		{ "NOTES:", report.WithSeverity(checking.SeverityNote) },
+	}
+
+	isFirst := true
+	for _, section := range sections {
+		if len(section.findings) == 0 { continue }
+		if !isFirst { _, _ = buf.WriteString("\n") }
+		isFirst = false
+
+		_, _ = fmt.Fprintf(buf, "%s\n", section.heading)
+		for _, finding := range section.findings {
+			writePlainFinding(buf, finding, opts)
+		}
+	}
+
+	if opts.ShowSuppressed && len(report.Suppressed) > 0 {
+		if !isFirst { _, _ = buf.WriteString("\n") }
+		_, _ = fmt.Fprintf(buf, "SUPPRESSED (%d):\n", len(report.Suppressed))
+		for _, finding := range report.Suppressed {
+			writePlainFinding(buf, finding, opts)
+		}
+	}
+}
+
+func writePlainFinding(buf *strings.Builder, finding checking.Finding, opts TextOpts) {
+	_, _ = fmt.Fprintf(buf, "  - %s\n", flagSummary(finding.Flag))
+	msg := finding.Flag.ContextMsg()
+	if !opts.HideContext && len(msg) > 0 {
+		_, _ = fmt.Fprintf(buf, "    %s\n", msg)
+	}
+}
+
+func flagSummary(flag checking.CheckFlag) string {
+	location := flag.Location()
+	if len(location.File) == 0 { return flag.Message() }
+	// flags about a whole file have no line
+	if location.Line == 0 { return fmt.Sprintf("%s | %s", location.File, flag.Message()) }
+	return fmt.Sprintf("%s:%d | %s", location.File, location.Line, flag.Message())
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold = "\x1b[1m"
+	ansiDim = "\x1b[2m"
+	ansiReverse = "\x1b[7m"
+	ansiRed = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan = "\x1b[36m"
+)
+
+type styler struct {
+	enabled bool
+}
+
+func (s styler) style(text string, codes ...string) string {
+	if !s.enabled || len(text) == 0 { return text }
+	return strings.Join(codes, "") + text + ansiReset
+}
+
+func (s styler) severity(severity checking.Severity) string {
+	label := fmt.Sprintf("%-7s", severity)
+	switch severity {
+		case checking.SeverityError: return s.style(label, ansiBold, ansiRed)
+		case checking.SeverityWarning: return s.style(label, ansiYellow)
+		default: return s.style(label, ansiCyan)
+	}
+}
+
+// Findings which aren't in any particular file are grouped under this heading.
+const repoGroupHeading = "(repository)"
+const suppressedGroupHeading = "(suppressed)"
+
+func writePrettyText(buf *strings.Builder, report checking.CheckReport, opts TextOpts) {
+	s := styler{enabled: opts.Color}
+
+	for i, group := range groupByFile(report.Findings) {
+		if i > 0 { _, _ = buf.WriteString("\n") }
+		heading := group.file
+		if len(heading) == 0 { heading = repoGroupHeading }
+		_, _ = fmt.Fprintf(buf, "%s\n", s.style(heading, ansiBold))
+
+		for _, finding := range group.findings {
+			writePrettyFinding(buf, s, finding, false, opts)
+		}
+	}
+
+	showSuppressed := opts.ShowSuppressed && len(report.Suppressed) > 0
+	if showSuppressed {
+		if len(report.Findings) > 0 { _, _ = buf.WriteString("\n") }
+		_, _ = fmt.Fprintf(buf, "%s\n", s.style(suppressedGroupHeading, ansiBold, ansiDim))
+		for _, finding := range report.Suppressed {
+			writePrettyFinding(buf, s, finding, true, opts)
+		}
+	}
+
+	if len(report.Findings) > 0 || showSuppressed { _, _ = buf.WriteString("\n") }
+	_, _ = fmt.Fprintf(buf, "%s\n", summaryLine(report, opts.ShowSuppressed))
+}
+
+func writePrettyFinding(
+	buf *strings.Builder,
+	s styler,
+	finding checking.Finding,
+	withFileName bool,
+	opts TextOpts,
+) {
+	location := finding.Flag.Location()
+	position := ""
+	if location.Line > 0 {
+		position = fmt.Sprintf("%d:%d", location.Line, max(location.Column, 1))
+	}
+	if withFileName && len(location.File) > 0 {
+		position = strings.TrimSuffix(location.File + ":" + position, ":")
+	}
+
+	_, _ = fmt.Fprintf(
+		buf,
+		"  %-8s %s %s %s\n",
+		position,
+		s.severity(finding.Severity),
+		finding.Flag.Message(),
+		s.style("["+finding.Check+"]", ansiDim),
+	)
+	if !opts.HideContext { writePrettyContext(buf, s, finding.Flag) }
+}
+
+const prettyContextIndent = "           "
+const tabDisplay = "    "
+
+// Lines with a highlighted part are shown in full, with the highlighted part in reverse video,
+// or underlined by carets when color is off. Otherwise, the usual context message is shown.
+func writePrettyContext(buf *strings.Builder, s styler, flag checking.CheckFlag) {
+	highlighter, isHighlighter := flag.(checking.LineHighlighter)
+	if !isHighlighter {
+		msg := flag.ContextMsg()
+		if len(msg) > 0 { _, _ = fmt.Fprintf(buf, "%s%s\n", prettyContextIndent, msg) }
+		return
+	}
+
+	line, start, end := highlighter.HighlightedLine()
+	start = min(max(start, 0), len(line))
+	end = min(max(end, start), len(line))
+	before := displayText(line[:start])
+	highlighted := displayText(line[start:end])
+	after := displayText(line[end:])
+
+	if s.enabled {
+		_, _ = fmt.Fprintf(
+			buf,
+			"%s%s%s%s\n",
+			prettyContextIndent, before, s.style(highlighted, ansiReverse), after,
+		)
+		return
+	}
+
+	_, _ = fmt.Fprintf(buf, "%s%s%s%s\n", prettyContextIndent, before, highlighted, after)
+	if len(highlighted) > 0 {
+		_, _ = fmt.Fprintf(
+			buf,
+			"%s%s%s\n",
+			prettyContextIndent,
+			strings.Repeat(" ", len([]rune(before))),
+			strings.Repeat("^", len([]rune(highlighted))),
+		)
+	}
+}
+
+// Tabs are expanded so that highlighting lines up regardless of the terminal's tab stops.
+func displayText(text string) string {
+	return strings.ReplaceAll(text, "\t", tabDisplay)
+}
+
+type fileGroup struct {
+	file string
+	findings []checking.Finding
+}
+
+// Group findings by file, in the order each file first appears. Findings without a file come
+// first, since they concern the repository as a whole.
+func groupByFile(findings []checking.Finding) []fileGroup {
+	groups := []fileGroup{{file: ""}}
+	groupIndexes := map[string]int{"": 0}
+	for _, finding := range findings {
+		file := finding.Flag.Location().File
+		index, exists := groupIndexes[file]
+		if !exists {
+			index = len(groups)
+			groupIndexes[file] = index
+			groups = append(groups, fileGroup{file: file})
+		}
+		groups[index].findings = append(groups[index].findings, finding)
+	}
+
+	if len(groups[0].findings) == 0 { groups = groups[1:] }
+	return groups
+}
+
+func summaryLine(report checking.CheckReport, showSuppressed bool) string {
+	hidden := make([]string, 0, 2)
+	if showSuppressed {
+		hidden = append(hidden, fmt.Sprintf("%d suppressed", len(report.Suppressed)))
+	}
+	if len(report.Baselined) > 0 {
+		hidden = append(hidden, fmt.Sprintf("%d in baseline", len(report.Baselined)))
+	}
+	hiddenCounts := ""
+	if len(hidden) > 0 { hiddenCounts = " (" + strings.Join(hidden, ", ") + ")" }
+
+	if len(report.Findings) == 0 { return "No issues found." + hiddenCounts }
+	return fmt.Sprintf(
+		"%s, %s, %s%s",
+		pluralize(len(report.WithSeverity(checking.SeverityError)), "error"),
+		pluralize(len(report.WithSeverity(checking.SeverityWarning)), "warning"),
+		pluralize(len(report.WithSeverity(checking.SeverityNote)), "note"),
+		hiddenCounts,
+	)
+}
+
+func pluralize(count int, noun string) string {
+	if count == 1 { return fmt.Sprintf("%d %s", count, noun) }
+	return fmt.Sprintf("%d %ss", count, noun)
+}
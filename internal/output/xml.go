@@ -0,0 +1,169 @@
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/lorentzforces/check-changes/internal/checking"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name `xml:"testsuites"`
+	Name string `xml:"name,attr"`
+	Tests int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	Suites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name string `xml:"name,attr"`
+	Tests int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name string `xml:"name,attr"`
+	ClassName string `xml:"classname,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Type string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+	Text string `xml:",chardata"`
+}
+
+// Write the report as JUnit XML. Each of the provided checks (which should be those that ran)
+// becomes a test suite, with a failing test case for each finding. Checks without any findings get
+// a single passing test case, so that they still show up in test report UIs. Findings from checks
+// which weren't provided (such as unused suppressions) get suites of their own.
+func WriteJUnit(out io.Writer, report checking.CheckReport, checks []checking.Check) error {
+	checkNames := make([]string, 0, len(checks))
+	for _, check := range checks {
+		checkNames = append(checkNames, check.Name())
+	}
+	for _, finding := range report.Findings {
+		if !slices.Contains(checkNames, finding.Check) {
+			checkNames = append(checkNames, finding.Check)
+		}
+	}
+
+	suites := junitTestSuites{
+		Name: toolName,
+		Suites: make([]junitTestSuite, 0, len(checkNames)),
+	}
+
+	for _, checkName := range checkNames {
+		suite := junitTestSuite{Name: checkName}
+		className := toolName + "." + checkName
+		for _, finding := range report.Findings {
+			if finding.Check != checkName { continue }
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name: testCaseName(finding),
+				ClassName: className,
+				Failure: &junitFailure{
+					Type: finding.Severity.String(),
+					Message: finding.Flag.Message(),
+					Text: finding.Flag.ContextMsg(),
+				},
+			})
+		}
+
+		suite.Failures = len(suite.TestCases)
+		if suite.Failures == 0 {
+			suite.TestCases = []junitTestCase{{Name: checkName, ClassName: className}}
+		}
+		suite.Tests = len(suite.TestCases)
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	return writeXML(out, suites)
+}
+
+func testCaseName(finding checking.Finding) string {
+	location := finding.Flag.Location()
+	if len(location.File) == 0 { return finding.Flag.Message() }
+	if location.Line == 0 { return location.File }
+	return fmt.Sprintf("%s:%d", location.File, location.Line)
+}
+
+type checkstyleReport struct {
+	XMLName xml.Name `xml:"checkstyle"`
+	Version string `xml:"version,attr"`
+	Files []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name string `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line uint `xml:"line,attr,omitempty"`
+	Column uint `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message string `xml:"message,attr"`
+	Source string `xml:"source,attr"`
+}
+
+// Findings which aren't in any particular file (such as stash entries) are reported against the
+// repository as a whole.
+const checkstyleRepoFile = "."
+
+// Write the report as Checkstyle XML, with findings grouped by file in the order each file first
+// appears in the report.
+func WriteCheckstyle(out io.Writer, report checking.CheckReport) error {
+	result := checkstyleReport{
+		Version: "4.3",
+		Files: make([]checkstyleFile, 0),
+	}
+
+	fileIndexes := make(map[string]int)
+	for _, finding := range report.Findings {
+		location := finding.Flag.Location()
+		fileName := location.File
+		if len(fileName) == 0 { fileName = checkstyleRepoFile }
+
+		index, exists := fileIndexes[fileName]
+		if !exists {
+			index = len(result.Files)
+			fileIndexes[fileName] = index
+			result.Files = append(result.Files, checkstyleFile{Name: fileName})
+		}
+
+		file := &result.Files[index]
+		file.Errors = append(file.Errors, checkstyleError{
+			Line: location.Line,
+			Column: location.Column,
+			Severity: checkstyleSeverity(finding.Severity),
+			Message: finding.Flag.Message(),
+			Source: finding.Check,
+		})
+	}
+
+	return writeXML(out, result)
+}
+
+func checkstyleSeverity(severity checking.Severity) string {
+	if severity == checking.SeverityNote { return "info" }
+	return severity.String()
+}
+
+func writeXML(out io.Writer, document any) error {
+	_, err := io.WriteString(out, xml.Header)
+	if err != nil { return err }
+
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(document)
+	if err != nil { return err }
+
+	_, err = io.WriteString(out, "\n")
+	return err
+}
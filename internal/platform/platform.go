@@ -35,3 +35,10 @@ func AssertNoErr(err error) {
 func SplitLines(s string) []string {
 	return strings.FieldsFunc(s, func(c rune) bool {return c == '\n' || c == '\r'})
 }
+
+// Splits on newlines only, so that carriage returns stay at the end of their lines, for output in
+// which line endings matter. Empty lines are kept, but a final newline doesn't make an empty line.
+func SplitNewlines(s string) []string {
+	if len(s) == 0 { return []string{} }
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}